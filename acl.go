@@ -0,0 +1,24 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// setACL sets the canned ACL objects are written with on input.
+func (c *Cache) setACL(input *s3.PutObjectInput) error {
+	if c.ACL == "" {
+		return nil
+	}
+
+	for _, v := range s3.ObjectCannedACL_Values() {
+		if c.ACL == v {
+			input.ACL = optionalString(c.ACL)
+			return nil
+		}
+	}
+	return fmt.Errorf("s3cache: unknown canned ACL %q", c.ACL)
+}
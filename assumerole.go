@@ -0,0 +1,41 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import "github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+
+// assumeRoleCredentials is replaced in tests.
+var assumeRoleCredentials = stscreds.NewCredentials
+
+// AssumeRole is the IAM role NewWithAssumeRole accesses the bucket with.
+type AssumeRole struct {
+	// RoleARN is the ARN of the role to assume.
+	RoleARN string
+	// ExternalID is the external ID required by the trust policy of the
+	// role, if any.
+	ExternalID string
+	// SessionName identifies the session in CloudTrail. If empty, the SDK
+	// generates one.
+	SessionName string
+}
+
+// NewWithAssumeRole is like New, but accesses the bucket with temporary
+// credentials of role, e.g. if the bucket is in another account. The
+// credentials of the default chain are used to call STS AssumeRole, and the
+// assumed credentials are renewed before they expire.
+func NewWithAssumeRole(region, bucket string, role AssumeRole, opts ...Option) (*Cache, error) {
+	return New(region, bucket, append(opts, withAssumeRole(role))...)
+}
+
+func withAssumeRole(role AssumeRole) Option {
+	return func(o *options) {
+		o.assumeRole = &role
+	}
+}
+
+func (r *AssumeRole) provider(p *stscreds.AssumeRoleProvider) {
+	p.ExternalID = optionalString(r.ExternalID)
+	if r.SessionName != "" {
+		p.RoleSessionName = r.SessionName
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithAssumeRole(t *testing.T) {
+	var (
+		roleARN  string
+		provider stscreds.AssumeRoleProvider
+	)
+	creds := credentials.NewStaticCredentials("id", "secret", "token")
+	assumeRoleCredentials = func(c client.ConfigProvider, arn string, options ...func(*stscreds.AssumeRoleProvider)) *credentials.Credentials {
+		roleARN = arn
+		for _, option := range options {
+			option(&provider)
+		}
+		return creds
+	}
+	defer func() {
+		assumeRoleCredentials = stscreds.NewCredentials
+	}()
+
+	cache, err := NewWithAssumeRole("eu-west-1", "my-bucket", AssumeRole{
+		RoleARN:     "arn:aws:iam::123456789012:role/certs",
+		ExternalID:  "external",
+		SessionName: "autocert",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "arn:aws:iam::123456789012:role/certs", roleARN)
+	assert.Equal(t, "external", aws.StringValue(provider.ExternalID))
+	assert.Equal(t, "autocert", provider.RoleSessionName)
+
+	svc, ok := cache.s3.(*s3.S3)
+	if assert.True(t, ok) {
+		assert.Equal(t, creds, svc.Config.Credentials)
+		assert.Equal(t, "eu-west-1", aws.StringValue(svc.Config.Region))
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// BucketValidation controls how strictly New validates bucket names.
+type BucketValidation int
+
+const (
+	// StrictBucketValidation enforces the current S3 bucket naming rules,
+	// e.g. no uppercase letters or underscores. This is the default.
+	StrictBucketValidation BucketValidation = iota
+	// RelaxedBucketValidation only rejects names no store accepts: empty names
+	// and names containing a scheme or a slash. Use this for legacy us-east-1
+	// buckets and S3-compatible stores, which allow names the current S3
+	// naming rules reject.
+	RelaxedBucketValidation
+	// NoBucketValidation disables validation.
+	NoBucketValidation
+)
+
+func validateBucket(bucket string, v BucketValidation) error {
+	var reason string
+	switch v {
+	case StrictBucketValidation:
+		reason = strictBucketError(bucket)
+	case RelaxedBucketValidation:
+		reason = relaxedBucketError(bucket)
+	}
+
+	if reason != "" {
+		return fmt.Errorf("s3cache: invalid bucket name %q: %s", bucket, reason)
+	}
+	return nil
+}
+
+func relaxedBucketError(bucket string) string {
+	switch {
+	case bucket == "":
+		return "must not be empty"
+	case strings.Contains(bucket, "://"):
+		return "must not contain a scheme"
+	case strings.Contains(bucket, "/"):
+		return "must not contain a slash"
+	}
+	return ""
+}
+
+// See https://docs.aws.amazon.com/AmazonS3/latest/userguide/bucketnamingrules.html
+func strictBucketError(bucket string) string {
+	if reason := relaxedBucketError(bucket); reason != "" {
+		return reason
+	}
+
+	if len(bucket) < 3 || len(bucket) > 63 {
+		return "must be between 3 and 63 characters long"
+	}
+	for _, r := range bucket {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '.' && r != '-' {
+			return "must only contain lowercase letters, numbers, dots and hyphens"
+		}
+	}
+
+	switch {
+	case !isAlphanumeric(bucket[0]) || !isAlphanumeric(bucket[len(bucket)-1]):
+		return "must begin and end with a letter or number"
+	case strings.Contains(bucket, ".."):
+		return "must not contain two adjacent dots"
+	case net.ParseIP(bucket) != nil:
+		return "must not be formatted as an IP address"
+	case strings.HasPrefix(bucket, "xn--"), strings.HasPrefix(bucket, "sthree-"):
+		return "must not use a reserved prefix"
+	case strings.HasSuffix(bucket, "-s3alias"), strings.HasSuffix(bucket, "--ol-s3"):
+		return "must not use a reserved suffix"
+	}
+	return ""
+}
+
+func isAlphanumeric(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9')
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateBucket(t *testing.T) {
+	for _, bucket := range []string{
+		"my-bucket",
+		"my.bucket.example.org",
+		"abc",
+		"0-bucket-9",
+	} {
+		assert.NoError(t, validateBucket(bucket, StrictBucketValidation), bucket)
+	}
+
+	for _, bucket := range []string{
+		"",
+		"ab",
+		"My-Bucket",
+		"my_bucket",
+		"s3://my-bucket",
+		"my-bucket/certs",
+		"-my-bucket",
+		"my-bucket.",
+		"my..bucket",
+		"192.168.1.1",
+		"xn--my-bucket",
+		"my-bucket-s3alias",
+		"a123456789012345678901234567890123456789012345678901234567890123",
+	} {
+		assert.Error(t, validateBucket(bucket, StrictBucketValidation), bucket)
+	}
+}
+
+func TestValidateBucketRelaxed(t *testing.T) {
+	assert.NoError(t, validateBucket("My_Bucket", RelaxedBucketValidation))
+	assert.Error(t, validateBucket("", RelaxedBucketValidation))
+	assert.Error(t, validateBucket("https://my-bucket", RelaxedBucketValidation))
+	assert.Error(t, validateBucket("my-bucket/certs", RelaxedBucketValidation))
+
+	assert.NoError(t, validateBucket("", NoBucketValidation))
+}
+
+func TestNewValidatesBucket(t *testing.T) {
+	calls, restore := stubSession(nil)
+	defer restore()
+
+	_, err := New("eu-west-1", "s3://my-bucket")
+	assert.EqualError(t, err, `s3cache: invalid bucket name "s3://my-bucket": must not contain a scheme`)
+	assert.Equal(t, 0, *calls)
+
+	_, err = New("eu-west-1", "My-Bucket")
+	assert.EqualError(t, err, `s3cache: invalid bucket name "My-Bucket": must only contain lowercase letters, numbers, dots and hyphens`)
+	assert.Equal(t, 0, *calls)
+
+	_, err = New("eu-west-1", "My_Bucket", WithBucketValidation(RelaxedBucketValidation), WithLazyInit(true))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudfront/sign"
+)
+
+// cdnURLExpiry is how long a signed CDN URL is valid. URLs are requested
+// right after signing, so this only needs to cover clock skew.
+const cdnURLExpiry = 5 * time.Minute
+
+// CDN is a distribution, e.g. CloudFront, serving the bucket as its origin.
+//
+// Get reads objects through the CDN, so they are served from the edge closest
+// to the host, and falls back to S3 if the CDN fails or does not have the
+// object. Put and Delete still go to S3 directly. The CDN keeps serving its
+// cached copy of an object until it expires there, so after a renewal Get may
+// return the previous certificate for up to the distribution's TTL. That
+// certificate is still valid, but autocert may consider it due for renewal
+// and renew it again. Keep the TTL short or invalidate renewed objects.
+type CDN struct {
+	// URL is the base URL of the distribution, e.g.
+	// "https://d111111abcdef8.cloudfront.net". Object keys are appended to it.
+	URL string
+	// KeyPairID and PrivateKey sign every request as a CloudFront signed URL
+	// with a canned policy. Leave them empty if the distribution does not
+	// restrict viewer access.
+	KeyPairID  string
+	PrivateKey *rsa.PrivateKey
+	// Client is used for requests to the CDN. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// get reads the object key through the CDN and passes its data and checksum
+// to decode.
+func (d *CDN) get(ctx context.Context, key string, decode func(key string, data []byte, sum string) ([]byte, error)) ([]byte, error) {
+	u, err := d.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3cache: CDN responded with %s", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength >= 0 && int64(len(data)) < resp.ContentLength {
+		return nil, ErrTruncated
+	}
+	return decode(key, data, resp.Header.Get("X-Amz-Meta-"+checksumMetadataKey))
+}
+
+// objectURL returns the, possibly signed, URL of the object key. S3 decodes a
+// "+" in the path as a space, so it is escaped as well.
+func (d *CDN) objectURL(key string) (string, error) {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.PathEscape(segment), "+", "%2B", -1)
+	}
+	u := strings.TrimSuffix(d.URL, "/") + "/" + strings.Join(segments, "/")
+
+	if d.PrivateKey == nil {
+		return u, nil
+	}
+	return sign.NewURLSigner(d.KeyPairID, d.PrivateKey).Sign(u, time.Now().Add(cdnURLExpiry))
+}
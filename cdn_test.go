@@ -0,0 +1,116 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCacheCDN(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/certs/dummy" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("cdn"))
+	}))
+	defer server.Close()
+
+	testS3Cache := &testS3{cache: map[string][]byte{"certs/dummy": []byte("s3"), "certs/other": []byte("s3")}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", cdn: &CDN{URL: server.URL}}
+	ctx := context.Background()
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("cdn"), b)
+
+	b, err = cache.Get(ctx, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3"), b)
+
+	_, err = cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+// s3OriginHandler serves the objects of testS3Cache like S3 as a CDN origin,
+// with the Content-Encoding and metadata they were written with.
+func s3OriginHandler(testS3Cache *testS3) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path[1:]
+		b, ok := testS3Cache.cache[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if input, ok := testS3Cache.inputs[key]; ok {
+			if input.ContentEncoding != nil {
+				w.Header().Set("Content-Encoding", *input.ContentEncoding)
+			}
+			for k, v := range input.Metadata {
+				w.Header().Set("X-Amz-Meta-"+k, aws.StringValue(v))
+			}
+		}
+		w.Write(b)
+	}
+}
+
+func TestCacheCDNCompressAEAD(t *testing.T) {
+	data := bytes.Repeat([]byte("-----BEGIN CERTIFICATE-----\n"), 10)
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	server := httptest.NewServer(s3OriginHandler(testS3Cache))
+	defer server.Close()
+
+	cache := &Cache{s3: testS3Cache, cdn: &CDN{URL: server.URL}, Compress: true, AEAD: newTestAEAD(t, 1), VerifyChecksum: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", data))
+	assert.Nil(t, testS3Cache.inputs["dummy"].ContentEncoding)
+
+	// Reads must not fall back to S3.
+	cache.s3 = &erroringS3{testS3: testS3Cache, err: errTestPut}
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	cache.s3, cache.AEAD = testS3Cache, nil
+	assert.NoError(t, cache.Put(ctx, "dummy", data))
+	assert.Equal(t, gzipEncoding, aws.StringValue(testS3Cache.inputs["dummy"].ContentEncoding))
+
+	cache.s3 = &erroringS3{testS3: testS3Cache, err: errTestPut}
+	b, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestCDNObjectURL(t *testing.T) {
+	cdn := &CDN{URL: "https://d111111abcdef8.cloudfront.net/"}
+	u, err := cdn.objectURL("certs/acme_account+key")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://d111111abcdef8.cloudfront.net/certs/acme_account%2Bkey", u)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdn.KeyPairID, cdn.PrivateKey = "APKAEXAMPLE", key
+	u, err = cdn.objectURL("certs/example.org")
+	assert.NoError(t, err)
+
+	parsed, err := url.Parse(u)
+	assert.NoError(t, err)
+	assert.Equal(t, "/certs/example.org", parsed.Path)
+	assert.Equal(t, "APKAEXAMPLE", parsed.Query().Get("Key-Pair-Id"))
+	assert.NotEmpty(t, parsed.Query().Get("Signature"))
+	assert.NotEmpty(t, parsed.Query().Get("Expires"))
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// ErrDomainMismatch is returned by Get if ValidateDomainMatch is set and the
+// certificate stored under a key is not valid for the domain of that key.
+var ErrDomainMismatch = errors.New("s3cache: certificate does not match domain")
+
+// errInvalidAccountKey is returned by verifyAccountKey if data does not hold
+// a private key.
+var errInvalidAccountKey = errors.New("s3cache: invalid account key")
+
+// certDomain returns the domain of a key autocert stores a certificate under.
+// These are the plain domain name, with a "+rsa" suffix for RSA certificates.
+// Every other key autocert uses (account key, challenge tokens) contains a "+"
+// or is the legacy "acme_account.key".
+func certDomain(key string) (string, bool) {
+	domain := strings.TrimSuffix(key, "+rsa")
+	if domain == "" || domain == "acme_account.key" || strings.Contains(domain, "+") {
+		return "", false
+	}
+	return domain, true
+}
+
+// verifyDomain checks that the leaf certificate of a bundle as written by
+// autocert (private key followed by the certificate chain, PEM encoded) is
+// valid for the domain.
+func verifyDomain(domain string, data []byte) error {
+	for {
+		var b *pem.Block
+		if b, data = pem.Decode(data); b == nil {
+			return ErrDomainMismatch
+		}
+		if b.Type != "CERTIFICATE" {
+			continue
+		}
+
+		leaf, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return err
+		}
+		if leaf.VerifyHostname(domain) != nil {
+			return ErrDomainMismatch
+		}
+		return nil
+	}
+}
+
+// tokenKeySuffix is appended by autocert to the token of an HTTP-01 challenge
+// to form the key it stores the key authorization under.
+const tokenKeySuffix = "+http-01"
+
+// isTokenKey reports whether key holds an HTTP-01 challenge token. Tokens are
+// written right before the CA validates them, possibly through another
+// instance, and live only as long as the challenge, so they are always read
+// from S3.
+func isTokenKey(key string) bool {
+	return strings.HasSuffix(key, tokenKeySuffix) && key != tokenKeySuffix
+}
+
+// accountKeys are the keys autocert stores the ACME account key under, the
+// current one and the legacy one.
+var accountKeys = []string{"acme_account+key", "acme_account.key"}
+
+func isAccountKey(key string) bool {
+	for _, k := range accountKeys {
+		if key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyAccountKey checks that data is a PEM encoded private key, as autocert
+// writes the ACME account key. autocert itself reads PKCS#1, PKCS#8 and EC
+// private keys.
+func verifyAccountKey(data []byte) error {
+	b, _ := pem.Decode(data)
+	if b == nil || !strings.Contains(b.Type, "PRIVATE KEY") {
+		return errInvalidAccountKey
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(b.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(b.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParseECPrivateKey(b.Bytes); err == nil {
+		return nil
+	}
+	return errInvalidAccountKey
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func testCertBundle(t *testing.T, domain string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return buf.Bytes()
+}
+
+func TestCertDomain(t *testing.T) {
+	for key, domain := range map[string]string{
+		"example.org":          "example.org",
+		"example.org+rsa":      "example.org",
+		"acme_account+key":     "",
+		"acme_account.key":     "",
+		"someToken+http-01":    "",
+		"example.org+token+01": "",
+	} {
+		d, ok := certDomain(key)
+		assert.Equal(t, domain, d, key)
+		assert.Equal(t, domain != "", ok, key)
+	}
+}
+
+func TestCacheValidateDomainMatch(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{
+		"example.org":      testCertBundle(t, "example.org"),
+		"example.org+rsa":  testCertBundle(t, "example.org"),
+		"example.com":      testCertBundle(t, "example.org"),
+		"acme_account+key": {1},
+	}}
+	cache := &Cache{s3: testS3Cache, ValidateDomainMatch: true}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	_, err = cache.Get(ctx, "example.org+rsa")
+	assert.NoError(t, err)
+	_, err = cache.Get(ctx, "acme_account+key")
+	assert.NoError(t, err)
+
+	_, err = cache.Get(ctx, "example.com")
+	assert.Equal(t, ErrDomainMismatch, err)
+
+	cache.ValidateDomainMatch = false
+	_, err = cache.Get(ctx, "example.com")
+	assert.NoError(t, err)
+}
+
+func TestCacheValidateAccountData(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	testS3Cache := &testS3{cache: map[string][]byte{
+		"acme_account+key": accountKey,
+		"acme_account.key": accountKey[:len(accountKey)/2],
+		"example.org":      {1},
+	}}
+	cache := &Cache{s3: testS3Cache, ValidateAccountData: true, MissTTL: -1}
+	ctx := context.Background()
+
+	b, err := cache.Get(ctx, "acme_account+key")
+	assert.NoError(t, err)
+	assert.Equal(t, accountKey, b)
+	_, err = cache.Get(ctx, "acme_account.key")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	_, err = cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+
+	cache.ValidateAccountData = false
+	_, err = cache.Get(ctx, "acme_account.key")
+	assert.NoError(t, err)
+}
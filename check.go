@@ -0,0 +1,80 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// checkKey is the object written and deleted again by Check.
+const checkKey = ".check"
+
+var errCheckMismatch = errors.New("s3cache: probe object read back differs")
+
+// Check verifies that the cache can list, write, read and delete objects
+// below its prefix by doing so with a probe object, so that applications
+// can fail fast at startup instead of on the first TLS handshake. The
+// returned error names the operation that failed, e.g.
+// "s3cache: check put: s3cache: access denied", and wraps ErrAccessDenied
+// if S3 denied it.
+//
+// The probe object is written like any other object, including SSE, tags
+// and object lock settings, so that bucket policies apply to it as well.
+// With ContentAddressed, its version is deleted along with it.
+// If ReadOnly is set, only listing is checked.
+func (c *Cache) Check(ctx context.Context) error {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return err
+	}
+	key := prefix + checkKey
+	c.log("S3 Cache Check %s", key)
+
+	data := []byte("s3cache check")
+	steps := []struct {
+		op string
+		fn func() error
+	}{
+		{"list", func() error {
+			_, err := c.isEmpty(ctx, prefix)
+			return err
+		}},
+		{"put", func() error {
+			return c.put(ctx, checkKey, key, data)
+		}},
+		{"get", func() error {
+			b, err := c.get(ctx, key)
+			if err == nil && !bytes.Equal(b, data) {
+				err = errCheckMismatch
+			}
+			return err
+		}},
+		{"delete", func() error {
+			if c.ContentAddressed {
+				if err := c.delete(ctx, contentKey(key, checksum(data))); err != nil {
+					return err
+				}
+			}
+			return c.delete(ctx, key)
+		}},
+	}
+	if c.ReadOnly {
+		steps = steps[:1]
+	}
+	for _, step := range steps {
+		err := c.refreshingCredentials(step.fn)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isAccessDenied(err) {
+			err = ErrAccessDenied
+		}
+		if err != nil {
+			return fmt.Errorf("s3cache: check %s: %w", step.op, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheCheck(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"certs/a": {1}}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/"}
+
+	assert.NoError(t, cache.Check(context.Background()))
+	assert.Contains(t, testS3Cache.inputs, "certs/"+checkKey)
+	assert.Equal(t, map[string][]byte{"certs/a": {1}}, testS3Cache.cache)
+}
+
+func TestCacheCheckContentAddressed(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"certs/a": {1}}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", ContentAddressed: true}
+
+	assert.NoError(t, cache.Check(context.Background()))
+	assert.Equal(t, map[string][]byte{"certs/a": {1}}, testS3Cache.cache)
+}
+
+func TestCacheCheckFailed(t *testing.T) {
+	cache := &Cache{s3: &failingPutS3{testS3: &testS3{cache: map[string][]byte{}}, fail: checkKey}}
+	err := cache.Check(context.Background())
+	assert.EqualError(t, err, "s3cache: check put: put failed")
+	assert.True(t, errors.Is(err, errTestPut))
+
+	cache = &Cache{s3: &testS3{cache: map[string][]byte{}, owner: "123"}, ExpectedBucketOwner: "456"}
+	err = cache.Check(context.Background())
+	assert.EqualError(t, err, "s3cache: check list: s3cache: access denied")
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+}
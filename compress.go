@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+)
+
+const gzipEncoding = "gzip"
+
+// gzipMagic starts every gzip stream. PEM encoded data, which is all autocert
+// stores besides challenge tokens, never starts with it.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// dictMagic starts every object compressed with one of CompressDictionaries.
+// It is followed by the ID of the dictionary and the DEFLATE stream.
+var dictMagic = []byte{0x00, 's', '3', 'd'}
+
+// dictIDSize is the length of a dictionary ID, the start of its SHA-256.
+const dictIDSize = 8
+
+// ErrUnknownDictionary is returned by Get if an object was compressed with a
+// dictionary that is not in CompressDictionaries.
+var ErrUnknownDictionary = errors.New("s3cache: object compressed with unknown dictionary")
+
+// compressDictionary returns the dictionary objects are compressed with, if
+// any.
+func (c *Cache) compressDictionary() []byte {
+	if len(c.CompressDictionaries) == 0 {
+		return nil
+	}
+	return c.CompressDictionaries[0]
+}
+
+func dictID(dict []byte) []byte {
+	sum := sha256.Sum256(dict)
+	return sum[:dictIDSize]
+}
+
+// compress compresses data with gzip, or with DEFLATE and the preset
+// dictionary dict if it is not nil, tagged with the ID of dict.
+func compress(data, dict []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if dict == nil {
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	buf.Write(dictMagic)
+	buf.Write(dictID(dict))
+	w, err := flate.NewWriterDict(&buf, flate.BestCompression, dict)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns data decompressed if it is gzip-compressed or
+// compressed with one of dicts, and as is otherwise. The magic bytes are
+// checked rather than the Content-Encoding of the object, since HTTP clients
+// may already have decompressed the data.
+func decompress(data []byte, dicts [][]byte) ([]byte, error) {
+	if bytes.HasPrefix(data, dictMagic) {
+		return decompressDict(data[len(dictMagic):], dicts)
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func decompressDict(data []byte, dicts [][]byte) ([]byte, error) {
+	if len(data) < dictIDSize {
+		return nil, ErrUnknownDictionary
+	}
+	id, data := data[:dictIDSize], data[dictIDSize:]
+	for _, dict := range dicts {
+		if !bytes.Equal(dictID(dict), id) {
+			continue
+		}
+
+		r := flate.NewReaderDict(bytes.NewReader(data), dict)
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, ErrUnknownDictionary
+}
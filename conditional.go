@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// validators are the ETag and modification time of an object. A read from
+// S3 for the memory layer carries them in its context: those of the data
+// kept in memory, which make the GetObject conditional, and those of the
+// object read, which are kept with its data.
+//
+// The ETag takes precedence. If-None-Match is sent whenever the ETag of the
+// data in memory is known, and If-Modified-Since only for stores that don't
+// return ETags. S3 answers either with 304 Not Modified if the object did
+// not change, which Get treats as a hit on the data in memory.
+type validators struct {
+	data     []byte
+	etag     string
+	modified time.Time
+
+	mu          sync.Mutex
+	objETag     string
+	objModified time.Time
+}
+
+type validatorsKey struct{}
+
+// memValidators returns the validators of the data of the object key kept
+// in memory, if any.
+func (c *Cache) memValidators(key string) *validators {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	v := &validators{}
+	if e, ok := c.mem[key]; ok && !e.miss {
+		v.data = e.data
+		v.etag = e.etag
+		v.modified = e.modified
+	}
+	return v
+}
+
+func validatorsFromContext(ctx context.Context) *validators {
+	v, _ := ctx.Value(validatorsKey{}).(*validators)
+	return v
+}
+
+// setConditions makes input conditional on the data kept in memory.
+func (v *validators) setConditions(input *s3.GetObjectInput) {
+	switch {
+	case v.etag != "":
+		input.IfNoneMatch = aws.String(v.etag)
+	case !v.modified.IsZero():
+		input.IfModifiedSince = aws.Time(v.modified)
+	}
+}
+
+// record keeps the validators of an object read. Hedged reads may call it
+// concurrently.
+func (v *validators) record(resp *s3.GetObjectOutput) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.objETag = aws.StringValue(resp.ETag)
+	v.objModified = aws.TimeValue(resp.LastModified)
+}
+
+// notModified keeps the validators of the data in memory, which the object
+// still matches.
+func (v *validators) notModified() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.objETag, v.objModified = v.etag, v.modified
+}
+
+func (v *validators) object() (etag string, modified time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.objETag, v.objModified
+}
+
+// isNotModified reports whether err answers a conditional GetObject with
+// 304 Not Modified.
+func isNotModified(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotModified
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// conditionalS3 answers conditional GetObjects like S3. With noETag set, it
+// returns no ETags, like some S3-compatible stores.
+type conditionalS3 struct {
+	*testS3
+	noETag bool
+	inputs []*s3.GetObjectInput
+}
+
+func (s *conditionalS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	s.inputs = append(s.inputs, input)
+
+	key := aws.StringValue(input.Key)
+	etag, modified := s.etag(key), s.modified[key]
+	if _, ok := s.cache[key]; ok {
+		if input.IfNoneMatch != nil && aws.StringValue(input.IfNoneMatch) == etag ||
+			input.IfModifiedSince != nil && !modified.After(aws.TimeValue(input.IfModifiedSince)) {
+			return nil, awserr.NewRequestFailure(awserr.New("NotModified", "Not Modified", nil), http.StatusNotModified, "")
+		}
+	}
+
+	resp, err := s.testS3.GetObjectWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !s.noETag {
+		resp.ETag = aws.String(etag)
+	}
+	resp.LastModified = aws.Time(modified)
+	return resp, nil
+}
+
+func TestCacheRevalidateConditional(t *testing.T) {
+	for _, noETag := range []bool{false, true} {
+		modified := time.Now().Add(-time.Hour).Truncate(time.Second)
+		testS3Cache := &conditionalS3{testS3: &testS3{
+			cache:    map[string][]byte{"dummy": {1}},
+			modified: map[string]time.Time{"dummy": modified},
+		}, noETag: noETag}
+		cache := &Cache{s3: testS3Cache, MemTTL: 10 * time.Millisecond, MemMaxStale: time.Hour}
+		ctx := context.Background()
+
+		_, err := cache.Get(ctx, "dummy")
+		assert.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+
+		// The object did not change, so S3 answers with 304.
+		b, err := cache.Get(ctx, "dummy")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1}, b)
+		waitForRead(cache, "dummy")
+		if assert.Len(t, testS3Cache.inputs, 2) {
+			if noETag {
+				assert.Nil(t, testS3Cache.inputs[1].IfNoneMatch)
+				assert.Equal(t, modified, aws.TimeValue(testS3Cache.inputs[1].IfModifiedSince))
+			} else {
+				assert.Equal(t, testS3Cache.etag("dummy"), aws.StringValue(testS3Cache.inputs[1].IfNoneMatch))
+				assert.Nil(t, testS3Cache.inputs[1].IfModifiedSince)
+			}
+		}
+
+		b, err = cache.Get(ctx, "dummy")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1}, b)
+		assert.Len(t, testS3Cache.inputs, 2)
+
+		// The object changed, so S3 answers with 200 and the new data.
+		testS3Cache.cache["dummy"] = []byte{2}
+		testS3Cache.modified["dummy"] = modified.Add(time.Minute)
+		time.Sleep(20 * time.Millisecond)
+
+		b, err = cache.Get(ctx, "dummy")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1}, b)
+		waitForRead(cache, "dummy")
+
+		b, err = cache.Get(ctx, "dummy")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{2}, b)
+		assert.Len(t, testS3Cache.inputs, 3)
+	}
+}
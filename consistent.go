@@ -0,0 +1,75 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Bounds of the retries of a miss with ConsistentRead.
+const (
+	consistentReadAttempts = 5
+	consistentReadDelay    = 100 * time.Millisecond
+)
+
+// markWritten records a successful Put of the object key for ConsistentRead.
+func (c *Cache) markWritten(key string) {
+	if c.ConsistentRead <= 0 {
+		return
+	}
+
+	c.writtenMu.Lock()
+	defer c.writtenMu.Unlock()
+
+	if c.written == nil {
+		c.written = map[string]time.Time{}
+	}
+	now := time.Now()
+	for k, t := range c.written {
+		if now.Sub(t) > c.ConsistentRead {
+			delete(c.written, k)
+		}
+	}
+	c.written[key] = now
+}
+
+// forgetWritten drops the object key after a Delete, whose misses are real.
+func (c *Cache) forgetWritten(key string) {
+	c.writtenMu.Lock()
+	defer c.writtenMu.Unlock()
+
+	delete(c.written, key)
+}
+
+// recentlyWritten reports whether the object key was written less than
+// ConsistentRead ago.
+func (c *Cache) recentlyWritten(key string) bool {
+	c.writtenMu.Lock()
+	defer c.writtenMu.Unlock()
+
+	t, ok := c.written[key]
+	return ok && time.Since(t) <= c.ConsistentRead
+}
+
+// consistentRead reads the object of the cache key name like read. If the
+// object is missing although it was recently written, the read is retried
+// a few times until the store has caught up.
+func (c *Cache) consistentRead(ctx context.Context, name, key string) ([]byte, error) {
+	data, err := c.read(ctx, name, key)
+	for i := 0; i < consistentReadAttempts && err == autocert.ErrCacheMiss && c.recentlyWritten(key); i++ {
+		c.log("S3 Cache Get %s missed after Put, retrying in %s", key, consistentReadDelay)
+
+		timer := time.NewTimer(consistentReadDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		data, err = c.read(ctx, name, key)
+	}
+	return data, err
+}
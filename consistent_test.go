@@ -0,0 +1,70 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// laggingS3 misses the next lag GetObjects, like an eventually consistent
+// store right after a write.
+type laggingS3 struct {
+	*testS3
+	lag  int
+	gets int
+}
+
+func (l *laggingS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	l.gets++
+	if l.lag > 0 {
+		l.lag--
+		return nil, awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), http.StatusNotFound, "")
+	}
+	return l.testS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheConsistentRead(t *testing.T) {
+	testS3Cache := &laggingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, ConsistentRead: time.Minute}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	testS3Cache.lag, testS3Cache.gets = 2, 0
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.Equal(t, 3, testS3Cache.gets)
+
+	testS3Cache.gets = 0
+	_, err = cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 1, testS3Cache.gets)
+
+	testS3Cache.gets = 0
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 1, testS3Cache.gets)
+}
+
+func TestCacheConsistentReadDisabled(t *testing.T) {
+	testS3Cache := &laggingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	testS3Cache.lag, testS3Cache.gets = 1, 0
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 1, testS3Cache.gets)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+const contentHashMetadataKey = "Content-Hash"
+
+// Version is a version of an object stored while ContentAddressed was enabled.
+type Version struct {
+	// Hash is the hex encoded SHA-256 of the data.
+	Hash string
+	// LastModified is the time this version was first written.
+	LastModified time.Time
+}
+
+func contentKey(key, hash string) string {
+	return versionsPrefix(key) + hash
+}
+
+func versionsPrefix(key string) string {
+	return key + "/versions/"
+}
+
+// putContent writes body, the data as it is stored, under the hash of data.
+func (c *Cache) putContent(ctx context.Context, svc s3iface.S3API, input *s3.PutObjectInput, data, body []byte) error {
+	hash := checksum(data)
+
+	content := *input
+	content.Key = aws.String(contentKey(*input.Key, hash))
+	content.Body = bytes.NewReader(body)
+	content.Metadata = nil
+	if _, err := svc.PutObjectWithContext(ctx, &content); err != nil {
+		return err
+	}
+
+	input.Metadata[contentHashMetadataKey] = aws.String(hash)
+	return nil
+}
+
+// Versions returns all versions stored for the specified key, oldest first.
+//
+// When ContentAddressed is enabled, every Put first writes the data to an
+// immutable object below the key, named after the hash of the data, and then
+// the key itself with the hash in its metadata. The key thus always points to
+// a version that exists, and Get keeps reading the key with a single request.
+// An interrupted Put leaves an unreferenced version behind, which is harmless.
+//
+// Versions are never deleted by the cache, not even by Delete, so storage
+// grows with every renewal. Use a lifecycle rule on the versions if the
+// history does not need to be kept forever.
+func (c *Cache) Versions(ctx context.Context, key string) ([]Version, error) {
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.log("S3 Cache Versions %s", key)
+
+	var versions []Version
+	prefix := versionsPrefix(key)
+	err = c.listObjects(ctx, prefix, func(obj *s3.Object) {
+		versions = append(versions, Version{
+			Hash:         strings.TrimPrefix(aws.StringValue(obj.Key), prefix),
+			LastModified: aws.TimeValue(obj.LastModified),
+		})
+	})
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if isAccessDenied(err) {
+		return nil, ErrAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].LastModified.Before(versions[j].LastModified)
+	})
+	return versions, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheContentAddressed(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", ContentAddressed: true}
+	ctx := context.Background()
+
+	for _, data := range [][]byte{{1}, {2}, {3}} {
+		assert.NoError(t, cache.Put(ctx, "example.org", data))
+	}
+
+	b, err := cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3}, b)
+
+	hash := aws.StringValue(testS3Cache.meta["certs/example.org"][contentHashMetadataKey])
+	assert.Equal(t, checksum([]byte{3}), hash)
+	assert.Equal(t, []byte{3}, testS3Cache.cache["certs/example.org/versions/"+hash])
+
+	versions, err := cache.Versions(ctx, "example.org")
+	assert.NoError(t, err)
+	var hashes []string
+	for _, v := range versions {
+		hashes = append(hashes, v.Hash)
+	}
+	assert.ElementsMatch(t, []string{checksum([]byte{1}), checksum([]byte{2}), checksum([]byte{3})}, hashes)
+
+	assert.NoError(t, cache.Delete(ctx, "example.org"))
+	versions, err = cache.Versions(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+}
+
+func TestCacheVersionsEmpty(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{"example.org": {1}}}}
+
+	versions, err := cache.Versions(context.Background(), "example.org")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// refreshingCredentials calls fn and, if RefreshExpiredCredentials is set and
+// fn failed because the credentials have expired, expires the credentials of
+// the client and calls fn once more.
+func (c *Cache) refreshingCredentials(fn func() error) error {
+	err := fn()
+	if !c.RefreshExpiredCredentials || !request.IsErrorExpiredCreds(err) {
+		return err
+	}
+
+	svc, ok := c.s3.(*s3.S3)
+	if !ok || svc.Config.Credentials == nil {
+		return err
+	}
+
+	c.log("S3 Cache refreshing expired credentials")
+	svc.Config.Credentials.Expire()
+	return fn()
+}
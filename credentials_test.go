@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type testProvider struct {
+	retrieved int
+	expired   bool
+}
+
+func (p *testProvider) Retrieve() (credentials.Value, error) {
+	p.retrieved++
+	p.expired = false
+	return credentials.Value{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+}
+
+func (p *testProvider) IsExpired() bool {
+	return p.expired
+}
+
+// newExpiringServer returns a server that rejects the first n requests with
+// an ExpiredToken error.
+func newExpiringServer(n int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n > 0 {
+			n--
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<Error><Code>ExpiredToken</Code><Message>The provided token has expired.</Message></Error>`))
+			return
+		}
+		w.Write([]byte{1})
+	}))
+}
+
+func newTestProviderCache(t *testing.T, url string, p credentials.Provider) *Cache {
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewCredentials(p),
+		Endpoint:         aws.String(url),
+		Region:           aws.String("eu-west-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewWithProvider(sess, "my-bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestRefreshExpiredCredentials(t *testing.T) {
+	server := newExpiringServer(1)
+	defer server.Close()
+
+	p := &testProvider{}
+	cache := newTestProviderCache(t, server.URL, p)
+	cache.RefreshExpiredCredentials = true
+
+	b, err := cache.Get(context.Background(), "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.Equal(t, 2, p.retrieved)
+}
+
+func TestRefreshExpiredCredentialsOnce(t *testing.T) {
+	server := newExpiringServer(2)
+	defer server.Close()
+
+	p := &testProvider{}
+	cache := newTestProviderCache(t, server.URL, p)
+	cache.RefreshExpiredCredentials = true
+
+	_, err := cache.Get(context.Background(), "dummy")
+	assert.Error(t, err)
+	assert.Equal(t, 2, p.retrieved)
+}
+
+func TestRefreshExpiredCredentialsDisabled(t *testing.T) {
+	server := newExpiringServer(1)
+	defer server.Close()
+
+	p := &testProvider{}
+	cache := newTestProviderCache(t, server.URL, p)
+
+	_, err := cache.Get(context.Background(), "dummy")
+	assert.Error(t, err)
+	assert.Equal(t, 1, p.retrieved)
+}
+
+func TestCacheMinIONotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message><Key>dummy</Key><BucketName>my-bucket</BucketName><Resource>/my-bucket/dummy</Resource></Error>`))
+	}))
+	defer server.Close()
+
+	cache := newTestProviderCache(t, server.URL, &testProvider{})
+
+	_, err := cache.Get(context.Background(), "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// deleteBatchSize is the maximum number of keys S3 deletes per request.
+const deleteBatchSize = 1000
+
+// DeleteMany removes the specified keys from the cache, using one request
+// per 1000 keys. If some keys could not be deleted, it returns a
+// *MultiError identifying them. The context is checked between
+// requests, so a canceled DeleteMany may have deleted some of the keys.
+func (c *Cache) DeleteMany(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if c.ReadOnly {
+		return ErrReadOnly
+	}
+
+	names := make(map[string]string, len(keys))
+	objects := make([]*s3.ObjectIdentifier, 0, len(keys))
+	for _, key := range keys {
+		objectKey, err := c.objectKey(ctx, key)
+		if err != nil {
+			return err
+		}
+		names[objectKey] = key
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(objectKey)})
+	}
+	c.log("S3 Cache DeleteMany %d keys", len(keys))
+
+	failed := map[string]error{}
+	for start := 0; start < len(objects); start += deleteBatchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + deleteBatchSize
+		if end > len(objects) {
+			end = len(objects)
+		}
+		batch := objects[start:end]
+
+		var resp *s3.DeleteObjectsOutput
+		err := c.retrying(ctx, func() error {
+			return c.refreshingCredentials(func() (err error) {
+				resp, err = c.deleteObjects(ctx, batch)
+				return err
+			})
+		})
+		for _, obj := range batch {
+			c.memInvalidate(*obj.Key)
+		}
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if isAccessDenied(err) {
+			err = ErrAccessDenied
+		}
+		if err != nil {
+			for _, obj := range batch {
+				failed[names[*obj.Key]] = err
+			}
+			continue
+		}
+		for _, e := range resp.Errors {
+			var err error = awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil)
+			if isAccessDenied(err) {
+				err = ErrAccessDenied
+			}
+			failed[names[aws.StringValue(e.Key)]] = err
+		}
+	}
+
+	if len(failed) < len(keys) && c.OnPrefixEmptied != nil {
+		c.notifyPrefixEmptied(ctx)
+	}
+	if len(failed) > 0 {
+		return &MultiError{Op: "deleting", Errors: failed}
+	}
+	return nil
+}
+
+func (c *Cache) deleteObjects(ctx context.Context, objects []*s3.ObjectIdentifier) (*s3.DeleteObjectsOutput, error) {
+	svc, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(c.bucket),
+		Delete: &s3.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(true),
+		},
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchDeletingS3 counts the DeleteObjects requests and fails deleting the
+// keys in fail.
+type batchDeletingS3 struct {
+	*testS3
+	batches int
+	fail    map[string]string
+}
+
+func (b *batchDeletingS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	b.batches++
+
+	var objects []*s3.ObjectIdentifier
+	var failed []*s3.Error
+	for _, obj := range input.Delete.Objects {
+		if code, ok := b.fail[*obj.Key]; ok {
+			failed = append(failed, &s3.Error{Key: obj.Key, Code: aws.String(code), Message: aws.String(code)})
+		} else {
+			objects = append(objects, obj)
+		}
+	}
+
+	in := *input
+	in.Delete = &s3.Delete{Objects: objects}
+	resp, err := b.testS3.DeleteObjectsWithContext(ctx, &in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	resp.Errors = failed
+	return resp, nil
+}
+
+func TestCacheDeleteMany(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	var keys []string
+	for i := 0; i < 2500; i++ {
+		key := strconv.Itoa(i)
+		keys = append(keys, key)
+		testS3Cache.cache["certs/"+key] = []byte{1}
+	}
+	testS3Cache.cache["certs/other"] = []byte{2}
+	svc := &batchDeletingS3{testS3: testS3Cache}
+	cache := &Cache{s3: svc, Prefix: "certs/"}
+
+	assert.NoError(t, cache.DeleteMany(context.Background(), keys))
+	assert.Equal(t, 3, svc.batches)
+	assert.Equal(t, map[string][]byte{"certs/other": {2}}, testS3Cache.cache)
+
+	assert.NoError(t, cache.DeleteMany(context.Background(), nil))
+	assert.Equal(t, 3, svc.batches)
+}
+
+func TestCacheDeleteManyErrors(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"a": {1}, "b": {2}, "c": {3}}}
+	cache := &Cache{s3: &batchDeletingS3{
+		testS3: testS3Cache,
+		fail:   map[string]string{"b": "AccessDenied", "c": "InternalError"},
+	}}
+
+	err := cache.DeleteMany(context.Background(), []string{"a", "b", "c"})
+	var deleteErr *MultiError
+	if assert.True(t, errors.As(err, &deleteErr)) {
+		assert.Len(t, deleteErr.Errors, 2)
+		assert.Equal(t, ErrAccessDenied, deleteErr.Errors["b"])
+		assert.EqualError(t, deleteErr.Errors["c"], "InternalError: InternalError")
+	}
+	assert.EqualError(t, err, "s3cache: deleting 2 keys failed: b: s3cache: access denied; c: InternalError: InternalError")
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+	assert.Equal(t, map[string][]byte{"b": {2}, "c": {3}}, testS3Cache.cache)
+}
+
+func TestCacheDeleteManyCanceled(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"a": {1}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, cache.DeleteMany(ctx, []string{"a"}))
+	assert.Equal(t, map[string][]byte{"a": {1}}, testS3Cache.cache)
+}
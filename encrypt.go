@@ -0,0 +1,38 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// ErrDecrypt is returned by Get if AEAD is set and the data of an object
+// cannot be decrypted, because it was written without AEAD, with another
+// key, under another object key, or was tampered with.
+var ErrDecrypt = errors.New("s3cache: decrypting object data failed")
+
+// encrypt seals data of the object key with AEAD under a random nonce, which
+// is prepended. The key is authenticated as associated data, so the object
+// can't be swapped with another one.
+func (c *Cache) encrypt(key string, data []byte) ([]byte, error) {
+	nonce := make([]byte, c.AEAD.NonceSize(), c.AEAD.NonceSize()+len(data)+c.AEAD.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.AEAD.Seal(nonce, nonce, data, []byte(key)), nil
+}
+
+func (c *Cache) decrypt(key string, data []byte) ([]byte, error) {
+	size := c.AEAD.NonceSize()
+	if len(data) < size {
+		return nil, ErrDecrypt
+	}
+
+	data, err := c.AEAD.Open(nil, data[:size], data[size:], []byte(key))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
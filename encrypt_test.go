@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func newTestAEAD(t *testing.T, key byte) cipher.AEAD {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{key}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return aead
+}
+
+func TestCacheAEAD(t *testing.T) {
+	data := bytes.Repeat([]byte("-----BEGIN CERTIFICATE-----\n"), 10)
+	testS3Cache := &testS3{cache: map[string][]byte{"legacy": data}}
+	cache := &Cache{s3: testS3Cache, AEAD: newTestAEAD(t, 1), Compress: true, VerifyChecksum: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", data))
+	assert.NotContains(t, string(testS3Cache.cache["dummy"]), "CERTIFICATE")
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+
+	_, err = cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	_, err = cache.Get(ctx, "legacy")
+	assert.Equal(t, ErrDecrypt, err)
+
+	cache.AEAD = newTestAEAD(t, 2)
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, ErrDecrypt, err)
+}
+
+func TestCacheAEADSwapped(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, AEAD: newTestAEAD(t, 1)}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "example.com", []byte{2}))
+	testS3Cache.cache["example.org"], testS3Cache.cache["example.com"] = testS3Cache.cache["example.com"], testS3Cache.cache["example.org"]
+
+	_, err := cache.Get(ctx, "example.org")
+	assert.Equal(t, ErrDecrypt, err)
+	_, err = cache.Get(ctx, "example.com")
+	assert.Equal(t, ErrDecrypt, err)
+}
+
+func TestCacheAEADNonce(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, AEAD: newTestAEAD(t, 1)}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "a", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "b", []byte{1}))
+	assert.NotEqual(t, testS3Cache.cache["a"], testS3Cache.cache["b"])
+	assert.Len(t, testS3Cache.cache["a"], cache.AEAD.NonceSize()+1+cache.AEAD.Overhead())
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import "time"
+
+// Event describes a completed cache operation.
+type Event struct {
+	// Op is the name of the operation, e.g. "Get".
+	Op string
+	// Key is the cache key as passed to the operation.
+	Key string
+	// Label is the label MetricsLabel returned for the operation, if set.
+	Label string
+	// Duration is the time the operation took.
+	Duration time.Duration
+	// Err is the error returned by the operation, if any.
+	Err error
+}
+
+// Events returns a channel on which an Event is published for every Get, Put
+// and Delete. The channel is created on the first call with a buffer of
+// EventBuffer events; operations before that are not published.
+//
+// Publishing never blocks an operation. If the buffer is full, the event is
+// dropped and counted, see DroppedEvents.
+func (c *Cache) Events() <-chan Event {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	if c.events == nil {
+		c.events = make(chan Event, c.EventBuffer)
+	}
+	return c.events
+}
+
+// DroppedEvents returns the number of events that were dropped because the
+// channel returned by Events was full.
+func (c *Cache) DroppedEvents() uint64 {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	return c.droppedEvents
+}
+
+func (c *Cache) emit(op, key, label string, start time.Time, err error) {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+
+	if c.events == nil {
+		return
+	}
+
+	select {
+	case c.events <- Event{Op: op, Key: key, Label: label, Duration: time.Since(start), Err: err}:
+	default:
+		c.droppedEvents++
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestEvents(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, EventBuffer: 3}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "before", []byte{1}))
+
+	events := cache.Events()
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	_, err := cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+
+	e := <-events
+	assert.Equal(t, "Put", e.Op)
+	assert.Equal(t, "dummy", e.Key)
+	assert.NoError(t, e.Err)
+
+	e = <-events
+	assert.Equal(t, "Get", e.Op)
+	assert.Equal(t, "nonexistent", e.Key)
+	assert.Equal(t, autocert.ErrCacheMiss, e.Err)
+
+	e = <-events
+	assert.Equal(t, "Delete", e.Op)
+	assert.Equal(t, uint64(0), cache.DroppedEvents())
+}
+
+func TestEventsDropped(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, EventBuffer: 1}
+	ctx := context.Background()
+
+	events := cache.Events()
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{2}))
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+
+	assert.Len(t, events, 1)
+	assert.Equal(t, uint64(2), cache.DroppedEvents())
+}
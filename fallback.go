@@ -0,0 +1,126 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// readRepairTimeout bounds a read-repair, which runs after the Get that
+// started it returned.
+const readRepairTimeout = time.Minute
+
+type fallbackCache struct {
+	primary   *Cache
+	secondary autocert.Cache
+
+	repairs chan struct{}
+	wg      sync.WaitGroup
+}
+
+// FallbackOption configures the cache returned by NewWithFallback.
+type FallbackOption func(*fallbackCache)
+
+// WithReadRepair makes Get copy data found in primary to secondary if
+// secondary misses it, e.g. because an earlier Put to secondary failed, so
+// drift between the two heals as keys are read. The repair runs in the
+// background, up to concurrency at once; a Get finding that many running
+// skips its repair. Every Get hitting primary then costs a Get of secondary,
+// and repairs write to secondary on the read path. Zero disables it.
+func WithReadRepair(concurrency int) FallbackOption {
+	return func(f *fallbackCache) {
+		f.repairs = nil
+		if concurrency > 0 {
+			f.repairs = make(chan struct{}, concurrency)
+		}
+	}
+}
+
+// NewWithFallback returns an autocert.Cache that keeps a copy of everything
+// written to primary in secondary, e.g. an autocert.DirCache, and reads from
+// it while S3 is unavailable.
+//
+// Get reads from primary and only falls back to secondary if primary fails
+// with an error other than autocert.ErrCacheMiss or the context being done.
+// A miss in primary is authoritative and returned as is. If secondary cannot
+// provide the data either, the error of primary is returned, so that an
+// outage is not mistaken for a miss and autocert does not issue a new
+// certificate.
+//
+// Put and Delete are applied to both caches, primary first. Both are always
+// attempted; the error of primary takes precedence over that of secondary.
+func NewWithFallback(primary *Cache, secondary autocert.Cache, opts ...FallbackOption) autocert.Cache {
+	f := &fallbackCache{primary: primary, secondary: secondary}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Get returns a certificate data for the specified key.
+func (f *fallbackCache) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := f.primary.Get(ctx, key)
+	if err == nil && f.repairs != nil {
+		f.readRepair(ctx, key, data)
+	}
+	if err == nil || err == autocert.ErrCacheMiss || ctx.Err() != nil {
+		return data, err
+	}
+
+	f.primary.log("S3 Cache Get %s failed, falling back: %v", key, err)
+	if data, fallbackErr := f.secondary.Get(ctx, key); fallbackErr == nil {
+		return data, nil
+	}
+	return nil, err
+}
+
+// Put stores the data in the cache under the specified key.
+func (f *fallbackCache) Put(ctx context.Context, key string, data []byte) error {
+	err := f.primary.Put(ctx, key, data)
+	if fallbackErr := f.secondary.Put(ctx, key, data); err == nil {
+		err = fallbackErr
+	}
+	return err
+}
+
+// Delete removes a certificate data from the cache under the specified key.
+func (f *fallbackCache) Delete(ctx context.Context, key string) error {
+	err := f.primary.Delete(ctx, key)
+	if fallbackErr := f.secondary.Delete(ctx, key); err == nil {
+		err = fallbackErr
+	}
+	return err
+}
+
+// readRepair writes data read from primary to secondary in the background,
+// if secondary misses it and fewer than the configured repairs are running.
+func (f *fallbackCache) readRepair(ctx context.Context, key string, data []byte) {
+	select {
+	case f.repairs <- struct{}{}:
+	default:
+		f.primary.log("S3 Cache read-repair of %s skipped, too many running", key)
+		return
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer func() { <-f.repairs }()
+
+		ctx, cancel := context.WithTimeout(detachedContext{ctx}, readRepairTimeout)
+		defer cancel()
+
+		_, err := f.secondary.Get(ctx, key)
+		if err != autocert.ErrCacheMiss {
+			return
+		}
+		f.primary.log("S3 Cache read-repair of %s", key)
+		if err := f.secondary.Put(ctx, key, data); err != nil {
+			f.primary.logError("S3 Cache read-repair of %s failed: %v", key, err)
+		}
+	}()
+}
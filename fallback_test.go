@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestFallbackCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	primary := &Cache{s3: &testS3{cache: map[string][]byte{}, owner: "111111111111"}, ExpectedBucketOwner: "111111111111"}
+	secondary := autocert.DirCache(dir)
+	cache := NewWithFallback(primary, secondary)
+	ctx := context.Background()
+
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	b, err := secondary.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	// Make S3 fail.
+	primary.ExpectedBucketOwner = "222222222222"
+
+	b, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	_, err = cache.Get(ctx, "nonexistent")
+	assert.Equal(t, ErrAccessDenied, err)
+
+	assert.Equal(t, ErrAccessDenied, cache.Delete(ctx, "dummy"))
+	_, err = secondary.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+func TestFallbackCacheMiss(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secondary := autocert.DirCache(dir)
+	assert.NoError(t, secondary.Put(context.Background(), "dummy", []byte{1}))
+	cache := NewWithFallback(&Cache{s3: &testS3{cache: map[string][]byte{}}}, secondary)
+
+	_, err = cache.Get(context.Background(), "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+func TestFallbackCacheReadRepair(t *testing.T) {
+	primary := &Cache{s3: &testS3{cache: map[string][]byte{"dummy": {1}}}}
+	secondary := NewMemoryCache()
+	cache := NewWithFallback(primary, secondary, WithReadRepair(1))
+	ctx := context.Background()
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	cache.(*fallbackCache).wg.Wait()
+
+	b, err = secondary.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	// Data already in secondary is left alone.
+	assert.NoError(t, secondary.Put(ctx, "dummy", []byte{2}))
+	_, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	cache.(*fallbackCache).wg.Wait()
+
+	b, err = secondary.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+}
+
+func TestFallbackCacheReadRepairConcurrency(t *testing.T) {
+	primary := &Cache{s3: &testS3{cache: map[string][]byte{"dummy": {1}}}}
+	secondary := NewMemoryCache()
+	cache := NewWithFallback(primary, secondary, WithReadRepair(1)).(*fallbackCache)
+	ctx := context.Background()
+
+	// Occupy the only repair slot, so the repair is skipped.
+	cache.repairs <- struct{}{}
+	_, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	<-cache.repairs
+	cache.wg.Wait()
+
+	_, err = secondary.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
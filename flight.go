@@ -0,0 +1,112 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import "context"
+
+// flight is a read of an object shared by concurrent Gets of its key.
+type flight struct {
+	done    chan struct{}
+	result  getResult
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// sharedRead reads the object of the cache key name like read, but
+// concurrent calls for the same key share a single read and all receive its
+// result. A caller whose context is done stops waiting without affecting the
+// others; the read is only canceled once no caller waits for it anymore.
+func (c *Cache) sharedRead(ctx context.Context, name, key string) ([]byte, error) {
+	c.flightMu.Lock()
+	f, ok := c.flights[key]
+	if ok {
+		c.log("S3 Cache Get %s joins read in flight", key)
+	} else {
+		readCtx, cancel := context.WithCancel(detachedContext{ctx})
+		f = c.startFlight(readCtx, cancel, name, key)
+	}
+	f.waiters++
+	c.flightMu.Unlock()
+
+	select {
+	case <-f.done:
+		return append([]byte(nil), f.result.data...), f.result.err
+	case <-ctx.Done():
+		c.leave(f, key)
+		return nil, ctx.Err()
+	}
+}
+
+// revalidate starts a read of the object key in the background, unless one
+// is in flight already, to refresh stale data kept in memory.
+func (c *Cache) revalidate(ctx context.Context, name, key string) {
+	c.flightMu.Lock()
+	defer c.flightMu.Unlock()
+
+	if c.flights[key] != nil {
+		return
+	}
+	c.log("S3 Cache Get %s is stale, revalidating", key)
+
+	timeoutCtx, cancelTimeout := c.withDefaultTimeout(detachedContext{ctx})
+	readCtx, cancel := context.WithCancel(timeoutCtx)
+	c.startFlight(readCtx, func() {
+		cancel()
+		cancelTimeout()
+	}, name, key)
+}
+
+// startFlight starts reading the object key with ctx, which cancel cancels.
+// c.flightMu must be held.
+func (c *Cache) startFlight(ctx context.Context, cancel context.CancelFunc, name, key string) *flight {
+	if c.flights == nil {
+		c.flights = map[string]*flight{}
+	}
+	f := &flight{done: make(chan struct{}), cancel: cancel}
+	c.flights[key] = f
+	go c.fly(ctx, f, name, key)
+	return f
+}
+
+func (c *Cache) fly(ctx context.Context, f *flight, name, key string) {
+	defer f.cancel()
+
+	gen := c.memGeneration()
+	v := c.memValidators(key)
+	data, err := c.consistentRead(context.WithValue(ctx, validatorsKey{}, v), name, key)
+	if isNotModified(err) {
+		c.log("S3 Cache Get %s not modified", key)
+		data, err = v.data, nil
+		v.notModified()
+	}
+	if !isTokenKey(name) {
+		c.memStoreRead(key, data, err, gen, v)
+	}
+
+	c.flightMu.Lock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.flightMu.Unlock()
+
+	f.result = getResult{data, err}
+	close(f.done)
+}
+
+// leave stops waiting for f. The last waiter cancels the read and waits
+// for it to return, like a Get without other waiters would. A canceled
+// flight no longer accepts waiters, so later Gets start a new read.
+func (c *Cache) leave(f *flight, key string) {
+	c.flightMu.Lock()
+	f.waiters--
+	last := f.waiters == 0
+	if last && c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.flightMu.Unlock()
+
+	if last {
+		f.cancel()
+		<-f.done
+	}
+}
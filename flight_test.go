@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// gatedS3 holds every GetObject until release is closed.
+type gatedS3 struct {
+	*testS3
+	release chan struct{}
+	gets    int32
+}
+
+func (g *gatedS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	atomic.AddInt32(&g.gets, 1)
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return g.testS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+// waitForWaiters waits until n Gets wait for the read of key.
+func waitForWaiters(cache *Cache, key string, n int) {
+	for {
+		cache.flightMu.Lock()
+		f := cache.flights[key]
+		ok := f != nil && f.waiters == n
+		cache.flightMu.Unlock()
+		if ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCacheGetShared(t *testing.T) {
+	testS3Cache := &gatedS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}, release: make(chan struct{})}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make([]getResult, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := cache.Get(ctx, "dummy")
+			results[i] = getResult{data, err}
+		}(i)
+	}
+	waitForWaiters(cache, "dummy", len(results))
+	close(testS3Cache.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&testS3Cache.gets))
+	for _, r := range results {
+		assert.Equal(t, getResult{[]byte{1}, nil}, r)
+	}
+}
+
+func TestCacheGetSharedMiss(t *testing.T) {
+	testS3Cache := &gatedS3{testS3: &testS3{cache: map[string][]byte{}}, release: make(chan struct{})}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = cache.Get(ctx, "dummy")
+		}(i)
+	}
+	waitForWaiters(cache, "dummy", len(errs))
+	close(testS3Cache.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&testS3Cache.gets))
+	assert.Equal(t, []error{autocert.ErrCacheMiss, autocert.ErrCacheMiss, autocert.ErrCacheMiss}, errs)
+}
+
+func TestCacheGetIssuanceStorm(t *testing.T) {
+	testS3Cache := &gatedS3{testS3: &testS3{cache: map[string][]byte{}}, release: make(chan struct{})}
+	cache := &Cache{s3: testS3Cache, MissTTL: DefaultMissTTL}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.Get(ctx, "example.org")
+			assert.Equal(t, autocert.ErrCacheMiss, err)
+		}()
+	}
+	waitForWaiters(cache, "example.org", 10)
+	close(testS3Cache.release)
+	wg.Wait()
+
+	_, err := cache.Get(ctx, "example.org")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&testS3Cache.gets))
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	b, err := cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+}
+
+func TestCacheGetSharedCanceled(t *testing.T) {
+	testS3Cache := &gatedS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}, release: make(chan struct{})}
+	cache := &Cache{s3: testS3Cache}
+
+	done := make(chan getResult)
+	go func() {
+		data, err := cache.Get(context.Background(), "dummy")
+		done <- getResult{data, err}
+	}()
+	waitForWaiters(cache, "dummy", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := cache.Get(ctx, "dummy")
+		canceled <- err
+	}()
+	waitForWaiters(cache, "dummy", 2)
+	cancel()
+	assert.Equal(t, context.Canceled, <-canceled)
+
+	close(testS3Cache.release)
+	assert.Equal(t, getResult{[]byte{1}, nil}, <-done)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&testS3Cache.gets))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ErrConflict is returned by Put when the object was modified by someone else
+// between reading its current state and writing the new data.
+var ErrConflict = errors.New("s3cache: object was modified concurrently")
+
+const generationMetadataKey = "Generation"
+
+// putGeneration writes the object with an incremented generation, conditional
+// on the ETag read alongside the current generation (or on the object not
+// existing yet).
+func (c *Cache) putGeneration(ctx context.Context, svc s3iface.S3API, input *s3.PutObjectInput) error {
+	var (
+		gen     int64
+		headers = map[string]string{"If-None-Match": "*"}
+	)
+
+	head, err := c.head(ctx, *input.Key)
+	switch {
+	case err == nil:
+		if gen, err = parseGeneration(head.Metadata); err != nil {
+			return err
+		}
+		headers = map[string]string{"If-Match": aws.StringValue(head.ETag)}
+	case !isNotFound(err):
+		return err
+	}
+
+	if input.Metadata == nil {
+		input.Metadata = map[string]*string{}
+	}
+	input.Metadata[generationMetadataKey] = aws.String(strconv.FormatInt(gen+1, 10))
+
+	_, err = svc.PutObjectWithContext(ctx, input, request.WithSetRequestHeaders(headers))
+	if isConflict(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func parseGeneration(metadata map[string]*string) (int64, error) {
+	v, ok := metadata[generationMetadataKey]
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseInt(aws.StringValue(v), 10, 64)
+}
+
+// isConflict reports whether err rejects a conditional write because the
+// object changed. A 409 OperationAborted only means that another operation on
+// the object is in progress, so it is retried instead, see isRetryable.
+func isConflict(err error) bool {
+	awsErr, ok := err.(awserr.RequestFailure)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.StatusCode() {
+	case http.StatusPreconditionFailed:
+		return true
+	case http.StatusConflict:
+		return awsErr.Code() != operationAbortedCode
+	}
+	return false
+}
+
+func (c *Cache) head(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	svc, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	})
+}
+
+// Generation returns the generation number stored with the object under the specified key.
+// Objects written without TrackGeneration report generation 0.
+func (c *Cache) Generation(ctx context.Context, key string) (int64, error) {
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	c.log("S3 Cache Generation %s", key)
+
+	var head *s3.HeadObjectOutput
+	err = c.refreshingCredentials(func() (err error) {
+		head, err = c.head(ctx, key)
+		return err
+	})
+	if err != nil && ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	if isNotFound(err) {
+		return 0, autocert.ErrCacheMiss
+	}
+	if isAccessDenied(err) {
+		return 0, ErrAccessDenied
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return parseGeneration(head.Metadata)
+}
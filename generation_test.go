@@ -0,0 +1,75 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestGeneration(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, TrackGeneration: true}
+	ctx := context.Background()
+
+	_, err := cache.Generation(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	gen, err := cache.Generation(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), gen)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{2}))
+	gen, err = cache.Generation(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), gen)
+}
+
+func TestGenerationUntracked(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	gen, err := cache.Generation(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), gen)
+}
+
+// staleHeadS3 simulates a concurrent writer by reporting an outdated
+// object state on HeadObject.
+type staleHeadS3 struct {
+	*testS3
+	missing bool
+}
+
+func (s *staleHeadS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if s.missing {
+		return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+	}
+	head, err := s.testS3.HeadObjectWithContext(ctx, input, opts...)
+	if err == nil {
+		head.ETag = aws.String(`"stale"`)
+	}
+	return head, err
+}
+
+func TestGenerationConflict(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"dummy": {1}}}
+	ctx := context.Background()
+
+	cache := &Cache{s3: &staleHeadS3{testS3: testS3Cache}, TrackGeneration: true}
+	assert.Equal(t, ErrConflict, cache.Put(ctx, "dummy", []byte{2}))
+
+	cache = &Cache{s3: &staleHeadS3{testS3: testS3Cache, missing: true}, TrackGeneration: true}
+	assert.Equal(t, ErrConflict, cache.Put(ctx, "dummy", []byte{2}))
+
+	assert.Equal(t, []byte{1}, testS3Cache.cache["dummy"])
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"time"
+)
+
+// graceKey reports whether a Put of the key gets PutGracePeriod.
+func (c *Cache) graceKey(key string) bool {
+	if c.PutGracePeriod <= 0 {
+		return false
+	}
+	if c.GraceKey != nil {
+		return c.GraceKey(key)
+	}
+	_, isCert := certDomain(key)
+	return isCert || isAccountKey(key)
+}
+
+// detachedContext carries the values of its parent, but is never canceled
+// with it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// withGrace returns a context that is canceled grace after parent is done.
+func withGrace(parent context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(detachedContext{parent})
+	go func() {
+		select {
+		case <-parent.Done():
+		case <-ctx.Done():
+			return
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// cancelableS3 fails every PutObject whose context is done.
+type cancelableS3 struct {
+	*testS3
+}
+
+func (c *cancelableS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.testS3.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestCachePutGracePeriod(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: &cancelableS3{testS3: testS3Cache}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, cache.Put(ctx, "example.org", []byte{1}))
+
+	cache.PutGracePeriod = time.Second
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{2}))
+	assert.Equal(t, context.Canceled, cache.Put(ctx, "token+http-01", []byte{3}))
+	assert.Equal(t, map[string][]byte{"example.org": {1}, "acme_account+key": {2}}, testS3Cache.cache)
+
+	cache.GraceKey = func(key string) bool { return key == "token+http-01" }
+	assert.NoError(t, cache.Put(ctx, "token+http-01", []byte{3}))
+}
+
+func TestCachePutGracePeriodExpired(t *testing.T) {
+	cache := &Cache{s3: &blockingS3{testS3: &testS3{cache: map[string][]byte{}}}, PutGracePeriod: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	assert.Equal(t, context.Canceled, cache.Put(ctx, "example.org", []byte{1}))
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// rollbackTimeout bounds the rollback of a failed PutGroup, which must not be
+// canceled with the context that likely caused the failure.
+const rollbackTimeout = time.Minute
+
+// PutGroup stores all entries in the cache. If any Put fails, the entries
+// already written are rolled back to their previous state: restored if they
+// existed before, deleted otherwise. S3 has no multi-object transactions, so
+// the rollback itself is best-effort and other readers may observe a mixed
+// state while the group is written. The rollback runs even if ctx is done,
+// bounded by rollbackTimeout. It returns the error of the failed Put.
+func (c *Cache) PutGroup(ctx context.Context, entries map[string][]byte) error {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	previous := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		data, err := c.Get(ctx, key)
+		if err != nil && err != autocert.ErrCacheMiss {
+			return err
+		}
+		previous[key] = data
+	}
+
+	for i, key := range keys {
+		if err := c.Put(ctx, key, entries[key]); err != nil {
+			c.rollback(ctx, keys[:i], previous)
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Cache) rollback(ctx context.Context, keys []string, previous map[string][]byte) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, rollbackTimeout)
+	defer cancel()
+
+	for _, key := range keys {
+		var err error
+		if data := previous[key]; data != nil {
+			err = c.Put(ctx, key, data)
+		} else {
+			err = c.Delete(ctx, key)
+		}
+		if err != nil {
+			c.logError("S3 Cache PutGroup rollback of %s failed: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestPut = errors.New("put failed")
+
+// failingPutS3 fails every PutObject for the key fail.
+type failingPutS3 struct {
+	*testS3
+	fail string
+}
+
+func (f *failingPutS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if *input.Key == f.fail {
+		return nil, errTestPut
+	}
+	return f.testS3.PutObjectWithContext(ctx, input, opts...)
+}
+
+// cancelingPutS3 cancels the context of the PutGroup when the Put of the key
+// fail fails and, like the SDK, fails requests with a done context.
+type cancelingPutS3 struct {
+	*failingPutS3
+	cancel context.CancelFunc
+}
+
+func (f *cancelingPutS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	output, err := f.failingPutS3.PutObjectWithContext(ctx, input, opts...)
+	if err != nil {
+		f.cancel()
+	}
+	return output, err
+}
+
+func (f *cancelingPutS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.testS3.DeleteObjectWithContext(ctx, input, opts...)
+}
+
+func TestCachePutGroup(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+
+	assert.NoError(t, cache.PutGroup(context.Background(), map[string][]byte{
+		"a": {1},
+		"b": {2},
+	}))
+	assert.Equal(t, map[string][]byte{"a": {1}, "b": {2}}, testS3Cache.cache)
+}
+
+func TestCachePutGroupRollback(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"b": {0}}}
+	cache := &Cache{s3: &failingPutS3{testS3: testS3Cache, fail: "c"}}
+
+	err := cache.PutGroup(context.Background(), map[string][]byte{
+		"a": {1},
+		"b": {2},
+		"c": {3},
+	})
+	assert.Equal(t, errTestPut, err)
+	assert.Equal(t, map[string][]byte{"b": {0}}, testS3Cache.cache)
+}
+
+func TestCachePutGroupRollbackCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testS3Cache := &testS3{cache: map[string][]byte{"b": {0}}}
+	cache := &Cache{s3: &cancelingPutS3{
+		failingPutS3: &failingPutS3{testS3: testS3Cache, fail: "c"},
+		cancel:       cancel,
+	}}
+
+	err := cache.PutGroup(ctx, map[string][]byte{
+		"a": {1},
+		"b": {2},
+		"c": {3},
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, map[string][]byte{"b": {0}}, testS3Cache.cache)
+}
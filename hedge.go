@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+type getResult struct {
+	data []byte
+	err  error
+}
+
+// hedgedGet gets the object, issuing a second request if the first one takes
+// longer than HedgeDelay. The request that loses the race is canceled and its
+// result is discarded.
+func (c *Cache) hedgedGet(ctx context.Context, key string) ([]byte, error) {
+	if c.HedgeDelay <= 0 {
+		return c.get(ctx, key)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan getResult, 2)
+	attempt := func() {
+		data, err := c.get(ctx, key)
+		results <- getResult{data, err}
+	}
+	go attempt()
+
+	timer := time.NewTimer(c.HedgeDelay)
+	defer timer.Stop()
+
+	select {
+	case r := <-results:
+		return r.data, r.err
+	case <-timer.C:
+	}
+
+	if !c.acquireHedge() {
+		r := <-results
+		return r.data, r.err
+	}
+	c.log("S3 Cache Get %s hedged", key)
+	go func() {
+		defer c.releaseHedge()
+		attempt()
+	}()
+
+	// A miss is as authoritative as data, but a failed attempt should not
+	// win over one that might still succeed.
+	r := <-results
+	if r.err != nil && !isNotFound(r.err) {
+		r = <-results
+	}
+	return r.data, r.err
+}
+
+func (c *Cache) acquireHedge() bool {
+	if n := atomic.AddInt32(&c.hedges, 1); c.MaxHedges > 0 && int(n) > c.MaxHedges {
+		atomic.AddInt32(&c.hedges, -1)
+		return false
+	}
+	return true
+}
+
+func (c *Cache) releaseHedge() {
+	atomic.AddInt32(&c.hedges, -1)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// slowFirstS3 blocks the first GetObject until release is closed or the
+// request is canceled.
+type slowFirstS3 struct {
+	*testS3
+	mu      sync.Mutex
+	calls   int
+	release chan struct{}
+}
+
+func (s *slowFirstS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	s.calls++
+	first := s.calls == 1
+	s.mu.Unlock()
+
+	if first {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return s.testS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func newSlowFirstS3() *slowFirstS3 {
+	return &slowFirstS3{
+		testS3:  &testS3{cache: map[string][]byte{"dummy": {1}}},
+		release: make(chan struct{}),
+	}
+}
+
+func TestCacheHedgedGet(t *testing.T) {
+	testS3Cache := newSlowFirstS3()
+	defer close(testS3Cache.release)
+
+	cache := &Cache{s3: testS3Cache, HedgeDelay: 10 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.Equal(t, 2, testS3Cache.calls)
+}
+
+func TestCacheHedgedGetMiss(t *testing.T) {
+	testS3Cache := newSlowFirstS3()
+	defer close(testS3Cache.release)
+
+	cache := &Cache{s3: testS3Cache, HedgeDelay: 10 * time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+func TestCacheHedgedGetLimit(t *testing.T) {
+	testS3Cache := newSlowFirstS3()
+
+	cache := &Cache{s3: testS3Cache, HedgeDelay: 10 * time.Millisecond, MaxHedges: 1}
+	cache.hedges = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(testS3Cache.release)
+	testS3Cache.mu.Lock()
+	assert.Equal(t, 1, testS3Cache.calls)
+	testS3Cache.mu.Unlock()
+}
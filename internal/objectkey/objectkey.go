@@ -0,0 +1,26 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+// Package objectkey builds the object keys shared by s3cache and s3cachev2,
+// so both store certificate data under the same keys.
+package objectkey
+
+import "strings"
+
+// DefaultSeparator is appended to a prefix if no separator is given.
+const DefaultSeparator = "/"
+
+// Prefix returns prefix ending with sep, or DefaultSeparator if sep is
+// empty. An empty prefix is returned as is, and so is any prefix if raw is
+// set.
+func Prefix(prefix, sep string, raw bool) string {
+	if prefix == "" || raw {
+		return prefix
+	}
+	if sep == "" {
+		sep = DefaultSeparator
+	}
+	if !strings.HasSuffix(prefix, sep) {
+		prefix += sep
+	}
+	return prefix
+}
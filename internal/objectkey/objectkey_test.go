@@ -0,0 +1,17 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package objectkey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefix(t *testing.T) {
+	assert.Equal(t, "", Prefix("", "", false))
+	assert.Equal(t, "certs/", Prefix("certs", "", false))
+	assert.Equal(t, "certs/", Prefix("certs/", "", false))
+	assert.Equal(t, "certs:", Prefix("certs", ":", false))
+	assert.Equal(t, "certs", Prefix("certs", "", true))
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// keepAliveKey is the object requested to keep connections warm. It is not
+// expected to exist.
+const keepAliveKey = ".keep-alive"
+
+// startKeepAlive issues a HeadObject every interval until Close is called.
+func (c *Cache) startKeepAlive(interval time.Duration) {
+	c.stop = make(chan struct{})
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				c.keepAlive(interval)
+			}
+		}
+	}()
+}
+
+func (c *Cache) keepAlive(timeout time.Duration) {
+	prefix, err := c.environmentPrefix()
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := c.head(ctx, prefix+keepAliveKey); err != nil && !isNotFound(err) && !isAccessDenied(err) {
+		c.logError("S3 Cache keep-alive failed: %v", err)
+	}
+}
+
+// Close stops the background work of the Cache and drops the data kept in
+// memory. Every operation started afterwards returns ErrClosed. It is safe to
+// call more than once.
+func (c *Cache) Close() error {
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		if c.stop != nil {
+			close(c.stop)
+		}
+		c.wg.Wait()
+
+		c.memMu.Lock()
+		c.mem = nil
+		c.memStats.Bytes = 0
+		c.memMu.Unlock()
+	})
+	return nil
+}
+
+func (c *Cache) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) != 0
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// headCountingS3 counts the HeadObjects per key.
+type headCountingS3 struct {
+	*testS3
+	mu    sync.Mutex
+	heads map[string]int
+}
+
+func (h *headCountingS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	h.mu.Lock()
+	h.heads[*input.Key]++
+	h.mu.Unlock()
+	return h.testS3.HeadObjectWithContext(ctx, input, opts...)
+}
+
+func (h *headCountingS3) count(key string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.heads[key]
+}
+
+func TestCacheKeepAlive(t *testing.T) {
+	testS3Cache := &headCountingS3{testS3: &testS3{cache: map[string][]byte{}}, heads: map[string]int{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/"}
+
+	cache.startKeepAlive(5 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, cache.Close())
+
+	n := testS3Cache.count("certs/" + keepAliveKey)
+	assert.True(t, n >= 2, "got %d keep-alive requests", n)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, n, testS3Cache.count("certs/"+keepAliveKey))
+	assert.NoError(t, cache.Close())
+}
+
+func TestCacheCloseWithoutKeepAlive(t *testing.T) {
+	cache := &Cache{}
+	assert.NoError(t, cache.Close())
+	assert.NoError(t, cache.Close())
+}
+
+func TestCacheClosed(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, MemTTL: time.Minute}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.NoError(t, cache.Close())
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, cache.Put(ctx, "dummy", []byte{2}))
+	assert.Equal(t, ErrClosed, cache.Delete(ctx, "dummy"))
+	_, err = cache.List(ctx)
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Key types substituted for {type} in a KeyTemplate, see KeyType.
+const (
+	KeyTypeAccount = "account"
+	KeyTypeCert    = "cert"
+	KeyTypeToken   = "token"
+	KeyTypeOther   = "other"
+)
+
+// errTemplateWithoutTenant is returned if MultiTenant is set with a
+// KeyTemplate that would store all tenants under the same keys.
+var errTemplateWithoutTenant = errors.New("s3cache: KeyTemplate requires {tenant} with MultiTenant")
+
+// KeyType classifies a cache key by what autocert stores under it: the ACME
+// account key, a certificate, an HTTP-01 challenge token, or anything else.
+func KeyType(key string) string {
+	switch {
+	case isAccountKey(key):
+		return KeyTypeAccount
+	case isTokenKey(key):
+		return KeyTypeToken
+	}
+	if _, ok := certDomain(key); ok {
+		return KeyTypeCert
+	}
+	return KeyTypeOther
+}
+
+// keyTemplate is a parsed KeyTemplate. The location parts, up to the first
+// {type} or {key}, form the prefix shared by all keys of an operation. The
+// name parts form the rest of the object key, which pattern matches.
+type keyTemplate struct {
+	location []templatePart
+	name     []templatePart
+	pattern  *regexp.Regexp
+	tenant   bool
+}
+
+// templatePart is either literal text or a placeholder.
+type templatePart struct {
+	literal     string
+	placeholder string
+}
+
+func parseKeyTemplate(s string) (*keyTemplate, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("s3cache: invalid KeyTemplate %q: %s", s, fmt.Sprintf(format, args...))
+	}
+
+	t := &keyTemplate{}
+	seen := map[string]bool{}
+	for rest := s; rest != ""; {
+		i := strings.IndexByte(rest, '{')
+		if i != 0 {
+			if i < 0 {
+				i = len(rest)
+			}
+			if strings.ContainsRune(rest[:i], '}') {
+				return nil, invalid("unmatched }")
+			}
+			t.add(templatePart{literal: rest[:i]})
+			rest = rest[i:]
+			continue
+		}
+
+		j := strings.IndexByte(rest, '}')
+		if j < 0 {
+			return nil, invalid("unclosed {")
+		}
+		name := rest[1:j]
+		rest = rest[j+1:]
+
+		switch name {
+		case "prefix", "env", "tenant":
+			if len(t.name) > 0 {
+				return nil, invalid("{%s} must precede {type} and {key}", name)
+			}
+		case "type", "key":
+		default:
+			return nil, invalid("unknown placeholder {%s}", name)
+		}
+		if seen[name] {
+			return nil, invalid("duplicate placeholder {%s}", name)
+		}
+		seen[name] = true
+		t.tenant = t.tenant || name == "tenant"
+		t.add(templatePart{placeholder: name})
+	}
+	if len(t.name) == 0 || t.name[len(t.name)-1].placeholder != "key" {
+		return nil, invalid("must end with {key}")
+	}
+
+	pattern := "^"
+	for _, p := range t.name {
+		switch p.placeholder {
+		case "":
+			pattern += regexp.QuoteMeta(p.literal)
+		case "type":
+			pattern += "(?:" + KeyTypeAccount + "|" + KeyTypeCert + "|" + KeyTypeToken + "|" + KeyTypeOther + ")"
+		case "key":
+			pattern += "([^/]+)"
+		}
+	}
+	t.pattern = regexp.MustCompile(pattern + "$")
+	return t, nil
+}
+
+// add appends p to the location parts, or to the name parts once {type} or
+// {key} appeared.
+func (t *keyTemplate) add(p templatePart) {
+	if len(t.name) > 0 || p.placeholder == "type" || p.placeholder == "key" {
+		t.name = append(t.name, p)
+	} else {
+		t.location = append(t.location, p)
+	}
+}
+
+// render substitutes the placeholders of parts with values. A placeholder
+// substituted with an empty value drops the slash following it, so that
+// e.g. "{env}/" disappears without an Environment.
+func render(parts []templatePart, values map[string]string) string {
+	var b strings.Builder
+	skipSlash := false
+	for _, p := range parts {
+		if p.placeholder != "" {
+			v := values[p.placeholder]
+			b.WriteString(v)
+			skipSlash = v == ""
+			continue
+		}
+
+		literal := p.literal
+		if skipSlash {
+			literal = strings.TrimPrefix(literal, "/")
+		}
+		b.WriteString(literal)
+		skipSlash = false
+	}
+	return b.String()
+}
+
+// keyTemplate returns the parsed KeyTemplate, or nil if it is not set. It
+// is parsed once.
+func (c *Cache) keyTemplate() (*keyTemplate, error) {
+	if c.KeyTemplate == "" {
+		return nil, nil
+	}
+	c.templateOnce.Do(func() {
+		c.template, c.templateErr = parseKeyTemplate(c.KeyTemplate)
+		if c.templateErr == nil && c.MultiTenant && !c.template.tenant {
+			c.templateErr = errTemplateWithoutTenant
+		}
+	})
+	return c.template, c.templateErr
+}
+
+// templatePrefix returns the location parts of t rendered for the operation
+// with ctx.
+func (c *Cache) templatePrefix(ctx context.Context, t *keyTemplate) (string, error) {
+	if strings.Contains(c.Environment, "/") || c.Environment == "" && c.RequireEnvironment {
+		return "", ErrInvalidEnvironment
+	}
+
+	values := map[string]string{
+		"prefix": strings.TrimSuffix(c.GetPrefix(), "/"),
+		"env":    c.Environment,
+	}
+	if t.tenant {
+		tenant, _ := TenantFromContext(ctx)
+		if tenant == "" && c.MultiTenant || strings.Contains(tenant, "/") {
+			return "", ErrInvalidTenant
+		}
+		values["tenant"] = tenant
+	}
+	return render(t.location, values), nil
+}
+
+// isCacheObject reports whether the object name holds a cache key.
+func (c *Cache) isCacheObject(name string) bool {
+	_, ok := c.cacheKey(name)
+	return ok
+}
+
+// cacheKey returns the key of the object name, an object key without the
+// prefix of the operation, as List reports it. ok is false for objects that
+// are not cache keys, like versions stored below a key.
+func (c *Cache) cacheKey(name string) (key string, ok bool) {
+	if t, _ := c.keyTemplate(); t != nil {
+		m := t.pattern.FindStringSubmatch(name)
+		if m == nil {
+			return "", false
+		}
+		return m[1], true
+	}
+	return name, !strings.Contains(name, "/")
+}
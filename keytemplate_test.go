@@ -0,0 +1,109 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyType(t *testing.T) {
+	assert.Equal(t, KeyTypeAccount, KeyType("acme_account+key"))
+	assert.Equal(t, KeyTypeAccount, KeyType("acme_account.key"))
+	assert.Equal(t, KeyTypeCert, KeyType("example.org"))
+	assert.Equal(t, KeyTypeCert, KeyType("example.org+rsa"))
+	assert.Equal(t, KeyTypeToken, KeyType("abc+http-01"))
+	assert.Equal(t, KeyTypeOther, KeyType("example.org+token"))
+}
+
+func TestParseKeyTemplate(t *testing.T) {
+	for _, template := range []string{
+		"{key}",
+		"{prefix}/{key}",
+		"{prefix}/{env}/{type}/{key}",
+		"{tenant}/{prefix}-{type}-{key}",
+	} {
+		_, err := parseKeyTemplate(template)
+		assert.NoError(t, err, template)
+	}
+
+	for template, reason := range map[string]string{
+		"":                      "must end with {key}",
+		"{prefix}/":             "must end with {key}",
+		"{key}/{type}":          "must end with {key}",
+		"{prefix}/{domain}":     "unknown placeholder {domain}",
+		"{prefix/{key}":         "unknown placeholder {prefix/{key}",
+		"{prefix}/{key":         "unclosed {",
+		"{prefix}}/{key}":       "unmatched }",
+		"{type}/{prefix}/{key}": "{prefix} must precede {type} and {key}",
+		"{key}/{key}":           "duplicate placeholder {key}",
+	} {
+		_, err := parseKeyTemplate(template)
+		assert.EqualError(t, err, `s3cache: invalid KeyTemplate "`+template+`": `+reason)
+	}
+}
+
+func TestCacheKeyTemplate(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", Environment: "prod", KeyTemplate: "{prefix}/{env}/{type}/{key}"}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{2}))
+	assert.NoError(t, cache.Put(ctx, "abc+http-01", []byte{3}))
+	assert.Equal(t, map[string][]byte{
+		"certs/prod/account/acme_account+key": {1},
+		"certs/prod/cert/example.org":         {2},
+		"certs/prod/token/abc+http-01":        {3},
+	}, testS3Cache.cache)
+
+	b, err := cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+
+	keys, err := cache.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme_account+key", "example.org", "abc+http-01"}, keys)
+
+	evicted, err := cache.EnforceSizeLimit(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, evicted)
+	assert.Contains(t, testS3Cache.cache, "certs/prod/account/acme_account+key")
+
+	assert.NoError(t, cache.Delete(ctx, "acme_account+key"))
+	assert.Empty(t, testS3Cache.cache)
+
+	cache = &Cache{s3: testS3Cache, Prefix: "certs/", KeyTemplate: "{prefix}/{env}/{type}/{key}"}
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{2}))
+	assert.Contains(t, testS3Cache.cache, "certs/cert/example.org")
+}
+
+func TestCacheKeyTemplateTenant(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs", MultiTenant: true, KeyTemplate: "{tenant}/{prefix}/{key}"}
+	ctx := WithTenant(context.Background(), "a")
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.Contains(t, testS3Cache.cache, "a/certs/example.org")
+	_, err := cache.Get(context.Background(), "example.org")
+	assert.Equal(t, ErrInvalidTenant, err)
+
+	cache = &Cache{s3: testS3Cache, MultiTenant: true, KeyTemplate: "{prefix}/{key}"}
+	_, err = cache.Get(ctx, "example.org")
+	assert.Equal(t, errTemplateWithoutTenant, err)
+}
+
+func TestNewValidatesKeyTemplate(t *testing.T) {
+	calls, restore := stubSession(nil)
+	defer restore()
+
+	_, err := New("eu-west-1", "my-bucket", WithKeyTemplate("{prefix}/{domain}/{key}"))
+	assert.EqualError(t, err, `s3cache: invalid KeyTemplate "{prefix}/{domain}/{key}": unknown placeholder {domain}`)
+	assert.Equal(t, 0, *calls)
+
+	cache, err := New("eu-west-1", "my-bucket", WithKeyTemplate("{prefix}/{type}/{key}"), WithLazyInit(true))
+	assert.NoError(t, err)
+	assert.Equal(t, "{prefix}/{type}/{key}", cache.KeyTemplate)
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// List returns the keys of all objects in the cache, e.g. to audit which
+// domains have certificates stored. Objects below a key, like the versions
+// kept by ContentAddressed, and other environments are not listed.
+//
+// With HashKeys set, the original keys are read from the metadata of every
+// object, which costs a HeadObject per object. With KeySecret or KeyFunc set,
+// the keys are returned as the objects are stored under.
+//
+// With ListFailurePartial, the keys listed before a page failed are returned
+// along with the error.
+func (c *Cache) List(ctx context.Context) ([]string, error) {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.log("S3 Cache List %s", prefix)
+
+	var keys []string
+	err = c.refreshingCredentials(func() error {
+		keys = nil
+		return c.listObjects(ctx, prefix, func(obj *s3.Object) {
+			if key, ok := c.cacheKey(strings.TrimPrefix(aws.StringValue(obj.Key), prefix)); ok {
+				keys = append(keys, key)
+			}
+		})
+	})
+	if err == nil && c.storesKeys() {
+		err = c.originalKeys(ctx, prefix, keys)
+	}
+	if err != nil && c.ListFailure != ListFailurePartial {
+		keys = nil
+	}
+	if err != nil && ctx.Err() != nil {
+		return keys, ctx.Err()
+	}
+
+	if isAccessDenied(err) {
+		return keys, ErrAccessDenied
+	}
+	return keys, err
+}
+
+// storesKeys reports whether Put keeps the original key in the metadata of
+// the object, as the object key is a hash of it.
+func (c *Cache) storesKeys() bool {
+	return c.HashKeys && c.KeySecret == nil && c.KeyFunc == nil
+}
+
+// originalKeys replaces the hashed keys of the objects below prefix with the
+// keys kept in their metadata. Keys of objects without it are kept.
+func (c *Cache) originalKeys(ctx context.Context, prefix string, keys []string) error {
+	for i, key := range keys {
+		var head *s3.HeadObjectOutput
+		err := c.refreshingCredentials(func() (err error) {
+			head, err = c.head(ctx, prefix+key)
+			return err
+		})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if v, ok := head.Metadata[keyMetadataKey]; ok {
+			keys[i] = aws.StringValue(v)
+		}
+	}
+	return nil
+}
+
+// ListFailure controls what listing the cache's prefix does when requesting a
+// page fails.
+type ListFailure int
+
+const (
+	// ListFailureAbort returns the error and drops the objects listed so far.
+	// This is the default.
+	ListFailureAbort ListFailure = iota
+	// ListFailureRetry retries the failed page like other requests, up to
+	// MaxRetries times, and continues the listing from it.
+	ListFailureRetry
+	// ListFailurePartial makes List return the keys listed before the failed
+	// page along with the error, so callers can decide whether they suffice.
+	ListFailurePartial
+)
+
+// errListNotAdvancing is returned if a store reports more pages without a
+// token to continue with, which would list the same page forever.
+var errListNotAdvancing = errors.New("s3cache: listing did not advance")
+
+// listPartitions are the characters after the prefix at which
+// ListConcurrency splits the key space, in the order S3 lists keys.
+const listPartitions = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// listObjects calls fn for every object whose key starts with prefix, in key
+// order, following pagination until all objects have been listed.
+func (c *Cache) listObjects(ctx context.Context, prefix string, fn func(*s3.Object)) error {
+	if c.ListConcurrency <= 1 {
+		return c.listRange(ctx, prefix, "", "", fn)
+	}
+	return c.listParallel(ctx, prefix, fn)
+}
+
+// listParallel lists the objects below prefix in ranges split at
+// listPartitions, up to ListConcurrency at once. The objects of a range are
+// buffered until all ranges before it have been passed to fn. If a range
+// fails, the ranges before it are still passed to fn.
+func (c *Cache) listParallel(ctx context.Context, prefix string, fn func(*s3.Object)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Range i holds the keys after bounds[i] up to and including
+	// bounds[i+1], where an empty bound is open.
+	bounds := []string{""}
+	for _, r := range listPartitions {
+		bounds = append(bounds, prefix+string(r))
+	}
+	bounds = append(bounds, "")
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		objects  = make([][]*s3.Object, len(bounds)-1)
+		errs     = make([]error, len(bounds)-1)
+		sem      = make(chan struct{}, c.ListConcurrency)
+	)
+	for i := range objects {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			errs[i] = c.listRange(ctx, prefix, bounds[i], bounds[i+1], func(obj *s3.Object) {
+				objects[i] = append(objects[i], obj)
+			})
+			if errs[i] != nil {
+				once.Do(func() {
+					firstErr = errs[i]
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range objects {
+		for _, obj := range objects[i] {
+			fn(obj)
+		}
+		if errs[i] != nil {
+			break
+		}
+	}
+	return firstErr
+}
+
+// listRange calls fn for every object whose key starts with prefix and
+// sorts after after and up to until, where empty bounds are open.
+func (c *Cache) listRange(ctx context.Context, prefix, after, until string, fn func(*s3.Object)) error {
+	page := listPage{prefix: prefix, after: after}
+	for {
+		var objects []*s3.Object
+		list := func() error {
+			return c.listPage(ctx, &page, &objects)
+		}
+		var err error
+		if c.ListFailure == ListFailureRetry {
+			err = c.retrying(ctx, list)
+		} else {
+			err = list()
+		}
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			if until != "" && aws.StringValue(obj.Key) > until {
+				return nil
+			}
+			fn(obj)
+		}
+
+		if page.done {
+			return nil
+		}
+	}
+}
+
+// isEmpty reports whether there are no objects whose key starts with prefix.
+func (c *Cache) isEmpty(ctx context.Context, prefix string) (bool, error) {
+	var objects []*s3.Object
+	if err := c.listPage(ctx, &listPage{prefix: prefix, maxKeys: 1}, &objects); err != nil {
+		return false, err
+	}
+	return len(objects) == 0, nil
+}
+
+// listPage is the position of a listing of the objects below prefix that
+// sort after after.
+type listPage struct {
+	prefix  string
+	after   string
+	maxKeys int64
+
+	// token continues the listing after the last page, which done marks.
+	token string
+	done  bool
+}
+
+// listPage lists the next page of p into objects and advances p, unless it
+// fails. Stores that do not
+// implement ListObjectsV2 are listed with ListObjects, e.g. older versions of
+// Ceph RGW and some S3-compatible appliances. The first such response switches
+// the cache to ListObjects for good.
+func (c *Cache) listPage(ctx context.Context, p *listPage, objects *[]*s3.Object) error {
+	svc, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	if atomic.LoadInt32(&c.listV1) == 0 {
+		input := &s3.ListObjectsV2Input{
+			Bucket:              aws.String(c.bucket),
+			Prefix:              aws.String(p.prefix),
+			StartAfter:          optionalString(p.after),
+			ContinuationToken:   optionalString(p.token),
+			ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+		}
+		if p.maxKeys > 0 {
+			input.MaxKeys = aws.Int64(p.maxKeys)
+		}
+		resp, err := svc.ListObjectsV2WithContext(ctx, input)
+		if !isListV2Unsupported(err) || p.token != "" {
+			if err != nil {
+				return err
+			}
+			return p.advance(objects, resp.Contents, aws.BoolValue(resp.IsTruncated), aws.StringValue(resp.NextContinuationToken))
+		}
+
+		c.log("S3 Cache ListObjectsV2 not supported, using ListObjects: %v", err)
+		atomic.StoreInt32(&c.listV1, 1)
+	}
+
+	// ListObjects starts after the marker, which is also how it continues.
+	marker := p.after
+	if p.token != "" {
+		marker = p.token
+	}
+	input := &s3.ListObjectsInput{
+		Bucket:              aws.String(c.bucket),
+		Prefix:              aws.String(p.prefix),
+		Marker:              optionalString(marker),
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	}
+	if p.maxKeys > 0 {
+		input.MaxKeys = aws.Int64(p.maxKeys)
+	}
+	resp, err := svc.ListObjectsWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	// NextMarker is only returned with a delimiter, otherwise the listing
+	// continues after the last key.
+	next := aws.StringValue(resp.NextMarker)
+	if next == "" && len(resp.Contents) > 0 {
+		next = aws.StringValue(resp.Contents[len(resp.Contents)-1].Key)
+	}
+	return p.advance(objects, resp.Contents, aws.BoolValue(resp.IsTruncated), next)
+}
+
+// advance moves p past a page of contents, which is truncated if more pages
+// follow after the token next.
+func (p *listPage) advance(objects *[]*s3.Object, contents []*s3.Object, truncated bool, next string) error {
+	if truncated && (next == "" || next == p.token) {
+		return errListNotAdvancing
+	}
+	*objects = contents
+	p.token = next
+	p.done = !truncated
+	return nil
+}
+
+// isListV2Unsupported reports whether err rejects a ListObjectsV2 request
+// because the store does not implement it.
+func isListV2Unsupported(err error) bool {
+	if hasErrorCode(err, "NotImplemented") {
+		return true
+	}
+	reqErr, ok := err.(awserr.RequestFailure)
+	return ok && reqErr.StatusCode() == http.StatusNotImplemented
+}
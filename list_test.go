@@ -0,0 +1,208 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// listV1S3 only implements the ListObjects API, paginated with markers.
+type listV1S3 struct {
+	*testS3
+	v2Calls int
+}
+
+func (s *listV1S3) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	s.v2Calls++
+	return nil, awserr.NewRequestFailure(awserr.New("NotImplemented", "A header you provided implies functionality that is not implemented.", nil), http.StatusNotImplemented, "")
+}
+
+func (s *listV1S3) ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error) {
+	resp, err := s.testS3.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:              input.Bucket,
+		Prefix:              input.Prefix,
+		StartAfter:          input.Marker,
+		MaxKeys:             input.MaxKeys,
+		ExpectedBucketOwner: input.ExpectedBucketOwner,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.ListObjectsOutput{Contents: resp.Contents, IsTruncated: resp.IsTruncated}, nil
+}
+
+// failingPageS3 fails the ListObjectsV2 request of the page after the key
+// fail the first failures times, or returns it again if loop is set.
+type failingPageS3 struct {
+	*testS3
+	fail     string
+	failures int
+	loop     bool
+}
+
+func (s *failingPageS3) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if aws.StringValue(input.ContinuationToken) == s.fail {
+		if s.loop {
+			return &s3.ListObjectsV2Output{IsTruncated: aws.Bool(true), NextContinuationToken: input.ContinuationToken}, nil
+		}
+		if s.failures > 0 {
+			s.failures--
+			return nil, awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error. Please try again.", nil), http.StatusInternalServerError, "")
+		}
+	}
+	return s.testS3.ListObjectsV2WithContext(ctx, input, opts...)
+}
+
+func TestCacheList(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{
+		"certs/acme_account+key":              {1},
+		"certs/example.com":                   {2},
+		"certs/example.org":                   {3},
+		"certs/example.org/versions/0123abcd": {3},
+		"certs/prod/example.net":              {4},
+		"other/example.de":                    {5},
+	}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/"}
+	ctx := context.Background()
+
+	keys, err := cache.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme_account+key", "example.com", "example.org"}, keys)
+
+	cache.Environment = "prod"
+	keys, err = cache.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.net"}, keys)
+
+	cache.Prefix = "empty/"
+	keys, err = cache.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestCacheListHashKeys(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", HashKeys: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{2}))
+	testS3Cache.cache["certs/"+hashKey("legacy")] = []byte{3}
+
+	keys, err := cache.List(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"acme_account+key", "example.org", hashKey("legacy")}, keys)
+}
+
+func TestCacheListExpectedBucketOwner(t *testing.T) {
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}, owner: "111111111111"}, ExpectedBucketOwner: "222222222222"}
+
+	_, err := cache.List(context.Background())
+	assert.Equal(t, ErrAccessDenied, err)
+}
+
+func TestCacheListConcurrency(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	for _, key := range []string{
+		"-", "0", "09", "9z", "A", "Zulu", "_", "a", "a0", "az", "b", "example.com",
+		"example.org", "example.org/versions/0123abcd", "m", "z", "za", "~", "\u00e9t\u00e9",
+	} {
+		testS3Cache.cache["certs/"+key] = []byte{1}
+	}
+	testS3Cache.cache["other/example.de"] = []byte{1}
+	ctx := context.Background()
+
+	serial := &Cache{s3: testS3Cache, Prefix: "certs/"}
+	expected, err := serial.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, expected, 18)
+
+	for _, concurrency := range []int{2, 8, 64} {
+		cache := &Cache{s3: testS3Cache, Prefix: "certs/", ListConcurrency: concurrency}
+		keys, err := cache.List(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, keys)
+	}
+}
+
+func TestCacheListV1(t *testing.T) {
+	testS3Cache := &listV1S3{testS3: &testS3{cache: map[string][]byte{
+		"certs/acme_account+key": {1},
+		"certs/example.com":      {2},
+		"certs/example.net":      {3},
+		"certs/example.org":      {4},
+		"other/example.de":       {5},
+	}}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/"}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		keys, err := cache.List(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"acme_account+key", "example.com", "example.net", "example.org"}, keys)
+	}
+	assert.Equal(t, 1, testS3Cache.v2Calls)
+
+	cache.ListConcurrency = 4
+	keys, err := cache.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"acme_account+key", "example.com", "example.net", "example.org"}, keys)
+}
+
+func TestCacheListFailure(t *testing.T) {
+	cache := func(failures int, mode ListFailure) *Cache {
+		return &Cache{
+			s3: &failingPageS3{testS3: &testS3{cache: map[string][]byte{
+				"example.com": {1},
+				"example.de":  {2},
+				"example.net": {3},
+				"example.org": {4},
+			}}, fail: "example.de", failures: failures},
+			MaxRetries:     1,
+			RetryBaseDelay: time.Millisecond,
+			ListFailure:    mode,
+		}
+	}
+	all := []string{"example.com", "example.de", "example.net", "example.org"}
+	ctx := context.Background()
+
+	keys, err := cache(1, ListFailureAbort).List(ctx)
+	assert.Error(t, err)
+	assert.Nil(t, keys)
+
+	keys, err = cache(1, ListFailureRetry).List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, all, keys)
+
+	keys, err = cache(2, ListFailureRetry).List(ctx)
+	assert.Error(t, err)
+	assert.Nil(t, keys)
+
+	keys, err = cache(1, ListFailurePartial).List(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"example.com", "example.de"}, keys)
+}
+
+func TestCacheListNotAdvancing(t *testing.T) {
+	cache := &Cache{
+		s3: &failingPageS3{testS3: &testS3{cache: map[string][]byte{
+			"example.com": {1},
+			"example.de":  {2},
+			"example.net": {3},
+		}}, fail: "example.de", loop: true},
+		ListFailure: ListFailurePartial,
+	}
+
+	keys, err := cache.List(context.Background())
+	assert.Equal(t, errListNotAdvancing, err)
+	assert.Equal(t, []string{"example.com", "example.de"}, keys)
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DefaultMissTTL is a conservative MissTTL. It absorbs bursts of Gets for a
+// missing key, while a certificate written by another instance is hidden for
+// at most a few seconds.
+const DefaultMissTTL = 5 * time.Second
+
+// missTTL returns MissTTL, DefaultMissTTL if it is zero, or zero if it is
+// negative.
+func (c *Cache) missTTL() time.Duration {
+	switch {
+	case c.MissTTL < 0:
+		return 0
+	case c.MissTTL == 0:
+		return DefaultMissTTL
+	}
+	return c.MissTTL
+}
+
+// memEntry is the data of an object, or the fact that it does not exist,
+// kept in memory until it expires. The validators of the object, if known,
+// make revalidating the data a conditional read.
+type memEntry struct {
+	data     []byte
+	miss     bool
+	expires  time.Time
+	etag     string
+	modified time.Time
+}
+
+// memLoad returns the entry of the object key, if any. Data that expired less
+// than MemMaxStale ago is returned as stale.
+func (c *Cache) memLoad(key string) (data []byte, miss, stale, ok bool) {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	e, ok := c.mem[key]
+	if !ok {
+		if c.MemTTL > 0 || c.missTTL() > 0 {
+			c.memStats.Misses++
+		}
+		return nil, false, false, false
+	}
+	if now := time.Now(); now.After(e.expires) {
+		if e.miss || now.After(e.expires.Add(c.MemMaxStale)) {
+			c.memDelete(key)
+			c.memStats.Evictions++
+			c.memStats.Misses++
+			return nil, false, false, false
+		}
+		stale = true
+	}
+	c.memStats.Hits++
+	return append([]byte(nil), e.data...), e.miss, stale, true
+}
+
+// memGeneration returns a number that changes with every write. A Get
+// obtains it before reading from S3 and passes it to memStoreRead, so that
+// data read concurrently with a write is not kept.
+func (c *Cache) memGeneration() uint64 {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	return c.memGen
+}
+
+// memStoreRead keeps the result of a Get if no write happened since gen,
+// along with the validators v recorded, if any.
+func (c *Cache) memStoreRead(key string, data []byte, err error, gen uint64, v *validators) {
+	e := memEntry{data: append([]byte(nil), data...)}
+	if v != nil {
+		e.etag, e.modified = v.object()
+	}
+	switch {
+	case err == nil && c.MemTTL > 0:
+		e.expires = time.Now().Add(c.MemTTL)
+	case err == autocert.ErrCacheMiss && c.missTTL() > 0:
+		e.miss = true
+		e.expires = time.Now().Add(c.missTTL())
+	case err == autocert.ErrCacheMiss:
+		// Stale data of a deleted object must not be served any longer.
+		c.memMu.Lock()
+		defer c.memMu.Unlock()
+
+		if c.memGen == gen {
+			c.memDelete(key)
+		}
+		return
+	default:
+		return
+	}
+
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	if c.memGen == gen {
+		c.memSet(key, e)
+	}
+}
+
+// memUpdate keeps the data written by a Put.
+func (c *Cache) memUpdate(key string, data []byte) {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	c.memGen++
+	if c.MemTTL > 0 {
+		c.memSet(key, memEntry{data: append([]byte(nil), data...), expires: time.Now().Add(c.MemTTL)})
+	} else {
+		c.memDelete(key)
+	}
+}
+
+// memInvalidate drops the entry of the object key.
+func (c *Cache) memInvalidate(key string) {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	c.memGen++
+	c.memDelete(key)
+}
+
+// InvalidateNegative forgets all misses remembered for MissTTL, e.g. after
+// certificates were issued out of band, so the next Gets read from S3. It is
+// a no-op if MissTTL is negative.
+func (c *Cache) InvalidateNegative() {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	c.memGen++
+	for key, e := range c.mem {
+		if e.miss {
+			c.memDelete(key)
+		}
+	}
+}
+
+// InvalidateNegativeKey forgets a miss of the specified key remembered for
+// MissTTL, like InvalidateNegative does for all keys.
+func (c *Cache) InvalidateNegativeKey(ctx context.Context, key string) error {
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	c.memGen++
+	if e, ok := c.mem[key]; ok && e.miss {
+		c.memDelete(key)
+	}
+	return nil
+}
+
+// MemStats is a snapshot of how effective the memory layer enabled by MemTTL
+// and MissTTL is, e.g. to tune them.
+type MemStats struct {
+	// Hits counts the Gets answered from memory, including remembered
+	// misses and stale data, Misses those that had to read from S3.
+	Hits, Misses uint64
+	// Evictions counts the entries dropped because they expired. Entries
+	// replaced or invalidated by writes are not counted.
+	Evictions uint64
+	// Entries is the number of entries held, Bytes the size of their data.
+	Entries int
+	Bytes   int64
+}
+
+// HitRate returns the fraction of Gets answered from memory, or 0 if there
+// were none.
+func (s MemStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// MemStats returns a snapshot of the memory layer's counters.
+func (c *Cache) MemStats() MemStats {
+	c.memMu.Lock()
+	defer c.memMu.Unlock()
+
+	stats := c.memStats
+	stats.Entries = len(c.mem)
+	return stats
+}
+
+// memSet and memDelete keep MemStats.Bytes. c.memMu must be held.
+func (c *Cache) memSet(key string, e memEntry) {
+	if c.mem == nil {
+		c.mem = map[string]memEntry{}
+	}
+	c.memDelete(key)
+	c.mem[key] = e
+	c.memStats.Bytes += int64(len(e.data))
+}
+
+func (c *Cache) memDelete(key string) {
+	if e, ok := c.mem[key]; ok {
+		c.memStats.Bytes -= int64(len(e.data))
+		delete(c.mem, key)
+	}
+}
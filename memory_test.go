@@ -0,0 +1,232 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCacheMemTTL(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: time.Hour, MissTTL: -1}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		b, err := cache.Get(ctx, "dummy")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{1}, b)
+	}
+	assert.Equal(t, 1, testS3Cache.gets)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{2}))
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+	assert.Equal(t, 1, testS3Cache.gets)
+
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 2, testS3Cache.gets)
+
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 3, testS3Cache.gets)
+}
+
+func TestCacheMemTTLExpired(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	testS3Cache.cache["dummy"] = []byte{2}
+
+	time.Sleep(20 * time.Millisecond)
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+	assert.Equal(t, 2, testS3Cache.gets)
+}
+
+func TestCacheMissTTL(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, MissTTL: time.Hour}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(ctx, "dummy")
+		assert.Equal(t, autocert.ErrCacheMiss, err)
+	}
+	assert.Equal(t, 1, testS3Cache.gets)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.Equal(t, 2, testS3Cache.gets)
+}
+
+func TestCacheInvalidateNegative(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: time.Hour, MissTTL: time.Hour}
+	ctx := context.Background()
+
+	for _, key := range []string{"dummy", "a", "b"} {
+		cache.Get(ctx, key)
+	}
+	assert.Equal(t, 3, testS3Cache.gets)
+
+	testS3Cache.cache["a"], testS3Cache.cache["b"] = []byte{2}, []byte{3}
+	assert.NoError(t, cache.InvalidateNegativeKey(ctx, "a"))
+	b, err := cache.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+	_, err = cache.Get(ctx, "b")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 4, testS3Cache.gets)
+
+	cache.InvalidateNegative()
+	b, err = cache.Get(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3}, b)
+	_, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, testS3Cache.gets)
+}
+
+// waitForRead waits until no read of key is in flight.
+func waitForRead(cache *Cache, key string) {
+	for {
+		cache.flightMu.Lock()
+		f := cache.flights[key]
+		cache.flightMu.Unlock()
+		if f == nil {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCacheMemMaxStale(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: 10 * time.Millisecond, MemMaxStale: time.Hour, MissTTL: -1}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	testS3Cache.cache["dummy"] = []byte{2}
+	time.Sleep(20 * time.Millisecond)
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	waitForRead(cache, "dummy")
+	assert.Equal(t, 2, testS3Cache.gets)
+
+	b, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+	assert.Equal(t, 2, testS3Cache.gets)
+
+	delete(testS3Cache.cache, "dummy")
+	time.Sleep(20 * time.Millisecond)
+	b, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+	waitForRead(cache, "dummy")
+
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 4, testS3Cache.gets)
+}
+
+func TestCacheMissTTLDefault(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(ctx, "dummy")
+		assert.Equal(t, autocert.ErrCacheMiss, err)
+	}
+	assert.Equal(t, 1, testS3Cache.gets)
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	cache = &Cache{s3: testS3Cache, MissTTL: -1}
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(ctx, "other")
+		assert.Equal(t, autocert.ErrCacheMiss, err)
+	}
+	assert.Equal(t, 4, testS3Cache.gets)
+}
+
+func TestCacheMemTTLTokenKey(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: time.Hour, MissTTL: time.Hour}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "someToken+http-01")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	testS3Cache.cache["someToken+http-01"] = []byte{1}
+	b, err := cache.Get(ctx, "someToken+http-01")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	assert.NoError(t, cache.Put(ctx, "otherToken+http-01", []byte{2}))
+	testS3Cache.cache["otherToken+http-01"] = []byte{3}
+	b, err = cache.Get(ctx, "otherToken+http-01")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3}, b)
+	assert.Equal(t, 3, testS3Cache.gets)
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{4}))
+	testS3Cache.cache["example.org"] = []byte{5}
+	b, err = cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{4}, b)
+	assert.Equal(t, 3, testS3Cache.gets)
+}
+
+func TestCacheMemStoreReadAfterWrite(t *testing.T) {
+	cache := &Cache{MemTTL: time.Hour}
+
+	gen := cache.memGeneration()
+	cache.memUpdate("dummy", []byte{2})
+	cache.memStoreRead("dummy", []byte{1}, nil, gen, nil)
+
+	data, miss, stale, ok := cache.memLoad("dummy")
+	assert.True(t, ok)
+	assert.False(t, miss)
+	assert.False(t, stale)
+	assert.Equal(t, []byte{2}, data)
+}
+
+func TestCacheMemStats(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"a": {1, 2}, "b": {3}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: 10 * time.Millisecond, MissTTL: -1}
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "a", "b", "a", "c"} {
+		cache.Get(ctx, key)
+	}
+	assert.Equal(t, MemStats{Hits: 2, Misses: 3, Entries: 2, Bytes: 3}, cache.MemStats())
+	assert.Equal(t, 0.4, cache.MemStats().HitRate())
+
+	time.Sleep(20 * time.Millisecond)
+	cache.Get(ctx, "a")
+	assert.Equal(t, MemStats{Hits: 2, Misses: 4, Evictions: 1, Entries: 2, Bytes: 3}, cache.MemStats())
+
+	assert.NoError(t, cache.Put(ctx, "b", []byte{4, 5, 6}))
+	assert.NoError(t, cache.Delete(ctx, "a"))
+	assert.Equal(t, MemStats{Hits: 2, Misses: 4, Evictions: 1, Entries: 1, Bytes: 3}, cache.MemStats())
+}
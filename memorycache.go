@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// MemoryCache is an autocert.Cache keeping data in a map. It is meant as a
+// test double for code using Cache and has the same semantics: Get of a
+// missing key returns autocert.ErrCacheMiss, Delete of a missing key
+// succeeds, and operations with a done context return the context's error.
+// It is safe for concurrent use.
+type MemoryCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+var _ autocert.Cache = (*MemoryCache)(nil)
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{data: map[string][]byte{}}
+}
+
+// Get returns a certificate data for the specified key.
+// If there's no such key, Get returns autocert.ErrCacheMiss.
+func (m *MemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.data[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Put stores the data in the cache under the specified key.
+func (m *MemoryCache) Put(ctx context.Context, key string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Delete removes a certificate data from the cache under the specified key.
+// If there's no such key in the cache, Delete returns nil.
+func (m *MemoryCache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data, key)
+	return nil
+}
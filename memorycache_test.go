@@ -0,0 +1,36 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache()
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	data := []byte{1, 2, 3, 4}
+	assert.NoError(t, cache.Put(ctx, "dummy", data))
+	data[0] = 0
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4}, b)
+
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, cache.Put(ctx, "dummy", data))
+}
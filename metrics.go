@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Metrics is notified of every completed Get, Put and Delete, e.g. to export
+// hit rates and latencies to Prometheus. Its methods are called concurrently.
+type Metrics interface {
+	// ObserveGet is called after a Get. A miss has hit and err unset; err is
+	// only set for failures.
+	ObserveGet(duration time.Duration, hit bool, err error)
+	// ObservePut is called after a Put.
+	ObservePut(duration time.Duration, err error)
+	// ObserveDelete is called after a Delete.
+	ObserveDelete(duration time.Duration, err error)
+}
+
+// LabeledMetrics is implemented by Metrics that break operations down by the
+// label MetricsLabel returns, e.g. per tenant. Its methods are called instead
+// of those of Metrics if MetricsLabel is set.
+type LabeledMetrics interface {
+	Metrics
+	// ObserveGetLabeled is called after a Get, like ObserveGet.
+	ObserveGetLabeled(label string, duration time.Duration, hit bool, err error)
+	// ObservePutLabeled is called after a Put.
+	ObservePutLabeled(label string, duration time.Duration, err error)
+	// ObserveDeleteLabeled is called after a Delete.
+	ObserveDeleteLabeled(label string, duration time.Duration, err error)
+}
+
+// TenantLabel is a MetricsLabel that labels operations with the tenant set
+// by WithTenant, or leaves them unlabeled.
+func TenantLabel(ctx context.Context, key string) string {
+	tenant, _ := TenantFromContext(ctx)
+	return tenant
+}
+
+func (c *Cache) metricsLabel(ctx context.Context, key string) string {
+	if c.MetricsLabel == nil {
+		return ""
+	}
+	return c.MetricsLabel(ctx, key)
+}
+
+// labeledMetrics returns Metrics as LabeledMetrics if operations are labeled.
+func (c *Cache) labeledMetrics() (LabeledMetrics, bool) {
+	if c.MetricsLabel == nil {
+		return nil, false
+	}
+	m, ok := c.Metrics.(LabeledMetrics)
+	return m, ok
+}
+
+func (c *Cache) observeGet(label string, start time.Time, err error) {
+	if c.Metrics == nil {
+		return
+	}
+	hit := err == nil
+	if err == autocert.ErrCacheMiss {
+		err = nil
+	}
+	if m, ok := c.labeledMetrics(); ok {
+		m.ObserveGetLabeled(label, time.Since(start), hit, err)
+		return
+	}
+	c.Metrics.ObserveGet(time.Since(start), hit, err)
+}
+
+func (c *Cache) observePut(label string, start time.Time, err error) {
+	if m, ok := c.labeledMetrics(); ok {
+		m.ObservePutLabeled(label, time.Since(start), err)
+	} else if c.Metrics != nil {
+		c.Metrics.ObservePut(time.Since(start), err)
+	}
+}
+
+func (c *Cache) observeDelete(label string, start time.Time, err error) {
+	if m, ok := c.labeledMetrics(); ok {
+		m.ObserveDeleteLabeled(label, time.Since(start), err)
+	} else if c.Metrics != nil {
+		c.Metrics.ObserveDelete(time.Since(start), err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type observation struct {
+	op  string
+	hit bool
+	err error
+}
+
+type testMetrics struct {
+	observations []observation
+}
+
+func (m *testMetrics) ObserveGet(duration time.Duration, hit bool, err error) {
+	m.observations = append(m.observations, observation{"Get", hit, err})
+}
+
+func (m *testMetrics) ObservePut(duration time.Duration, err error) {
+	m.observations = append(m.observations, observation{"Put", false, err})
+}
+
+func (m *testMetrics) ObserveDelete(duration time.Duration, err error) {
+	m.observations = append(m.observations, observation{"Delete", false, err})
+}
+
+func TestCacheMetrics(t *testing.T) {
+	m := &testMetrics{}
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, Metrics: m}
+	ctx := context.Background()
+
+	cache.Get(ctx, "dummy")
+	cache.Put(ctx, "dummy", []byte{1})
+	cache.Get(ctx, "dummy")
+	cache.Delete(ctx, "dummy")
+
+	cache.ExpectedBucketOwner = "111111111111"
+	cache.s3 = &testS3{cache: map[string][]byte{}, owner: "222222222222"}
+	cache.Get(ctx, "dummy")
+
+	assert.Equal(t, []observation{
+		{"Get", false, nil},
+		{"Put", false, nil},
+		{"Get", true, nil},
+		{"Delete", false, nil},
+		{"Get", false, ErrAccessDenied},
+	}, m.observations)
+}
+
+// labeledMetrics counts operations per label.
+type labeledMetrics struct {
+	testMetrics
+	counts map[string]int
+}
+
+func (m *labeledMetrics) ObserveGetLabeled(label string, duration time.Duration, hit bool, err error) {
+	m.counts[label+" Get"]++
+}
+
+func (m *labeledMetrics) ObservePutLabeled(label string, duration time.Duration, err error) {
+	m.counts[label+" Put"]++
+}
+
+func (m *labeledMetrics) ObserveDeleteLabeled(label string, duration time.Duration, err error) {
+	m.counts[label+" Delete"]++
+}
+
+func TestCacheMetricsLabel(t *testing.T) {
+	m := &labeledMetrics{counts: map[string]int{}}
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, Metrics: m, MultiTenant: true, MetricsLabel: TenantLabel}
+	a := WithTenant(context.Background(), "a")
+	b := WithTenant(context.Background(), "b")
+
+	cache.Put(a, "dummy", []byte{1})
+	cache.Get(a, "dummy")
+	cache.Get(b, "dummy")
+	cache.Delete(b, "dummy")
+	cache.Get(context.Background(), "dummy")
+
+	assert.Equal(t, map[string]int{
+		"a Put":    1,
+		"a Get":    1,
+		"b Get":    1,
+		"b Delete": 1,
+		" Get":     1,
+	}, m.counts)
+	assert.Empty(t, m.observations)
+
+	cache.MetricsLabel = nil
+	cache.Get(a, "dummy")
+	assert.Equal(t, []observation{{"Get", true, nil}}, m.observations)
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// errMigrateHashedKeys is returned by Migrate if a cache transforms its keys,
+// as the original keys cannot be recovered from the object keys.
+var errMigrateHashedKeys = errors.New("s3cache: Migrate does not support HashKeys, KeySecret, KeyFunc or KeyTemplate")
+
+// Migrate copies every object in src, as returned by List, to dst, e.g. when
+// moving to another bucket or region. Versions stored by ContentAddressed are
+// not copied. Progress is logged to the Logger of dst.
+//
+// If src and dst share their client, and thus their credentials, and store
+// objects the same way, objects are copied within S3 using CopyObject. They
+// keep their metadata and get the SSE, storage class, ACL, object lock and
+// tags of dst. Storing objects the same way means the same Compress and
+// CompressDictionaries, no AEAD on either and neither ContentAddressed nor
+// TrackGeneration on dst, as CopyObject can't apply these. Otherwise each
+// object is read with the settings of src and written with those of dst, so
+// this also re-encrypts or compresses objects if these settings differ.
+//
+// If some keys could not be copied, Migrate continues with the others and
+// returns a *MultiError identifying them.
+func Migrate(ctx context.Context, src, dst *Cache) error {
+	if src.transformsKeys() || dst.transformsKeys() {
+		return errMigrateHashedKeys
+	}
+	if dst.ReadOnly {
+		return ErrReadOnly
+	}
+
+	srcPrefix, err := src.keyPrefix(ctx)
+	if err != nil {
+		return err
+	}
+	dstPrefix, err := dst.keyPrefix(ctx)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	err = src.refreshingCredentials(func() error {
+		keys = nil
+		return src.listObjects(ctx, srcPrefix, func(obj *s3.Object) {
+			if key := strings.TrimPrefix(aws.StringValue(obj.Key), srcPrefix); !strings.Contains(key, "/") {
+				keys = append(keys, key)
+			}
+		})
+	})
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if isAccessDenied(err) {
+		return ErrAccessDenied
+	}
+	if err != nil {
+		return err
+	}
+
+	serverSide := src.canCopyTo(dst)
+	if serverSide {
+		dst.log("S3 Cache Migrate copying with CopyObject")
+	}
+
+	failed := map[string]error{}
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		dst.log("S3 Cache Migrate %s (%d/%d)", key, i+1, len(keys))
+		if err := migrate(ctx, src, dst, key, srcPrefix+key, dstPrefix+key, serverSide); err != nil {
+			dst.logError("S3 Cache Migrate %s failed: %v", key, err)
+			failed[key] = err
+		}
+	}
+	if len(failed) > 0 {
+		return &MultiError{Op: "migrating", Errors: failed}
+	}
+	return nil
+}
+
+// migrate copies the object of the cache key name from srcKey in src to
+// dstKey in dst, within S3 if serverSide is set.
+func migrate(ctx context.Context, src, dst *Cache, name, srcKey, dstKey string, serverSide bool) error {
+	var err error
+	if serverSide {
+		err = dst.retrying(ctx, func() error {
+			return dst.refreshingCredentials(func() error {
+				return dst.copyFrom(ctx, src, name, srcKey, dstKey)
+			})
+		})
+	} else {
+		var data []byte
+		err = src.retrying(ctx, func() error {
+			return src.refreshingCredentials(func() (err error) {
+				data, err = src.get(ctx, srcKey)
+				return err
+			})
+		})
+		if err == nil {
+			err = dst.retrying(ctx, func() error {
+				return dst.refreshingCredentials(func() error {
+					return dst.put(ctx, name, dstKey, data)
+				})
+			})
+		}
+	}
+	dst.memInvalidate(dstKey)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if isAccessDenied(err) {
+		return ErrAccessDenied
+	}
+	return err
+}
+
+// canCopyTo reports whether objects can be copied to dst with CopyObject, as
+// both caches share their client and store objects the same way.
+func (c *Cache) canCopyTo(dst *Cache) bool {
+	svc, err := c.client()
+	if err != nil {
+		return false
+	}
+	dstSvc, err := dst.client()
+	if err != nil || svc != dstSvc {
+		return false
+	}
+	return c.AEAD == nil && dst.AEAD == nil && c.Compress == dst.Compress &&
+		reflect.DeepEqual(c.CompressDictionaries, dst.CompressDictionaries) &&
+		!dst.ContentAddressed && !dst.TrackGeneration
+}
+
+// copyFrom copies srcKey in src to dstKey with CopyObject. Like put, it
+// retries without SSE-S3 if the store does not support it.
+func (c *Cache) copyFrom(ctx context.Context, src *Cache, name, srcKey, dstKey string) error {
+	sse := c.SSEType != "" || c.sseSupported()
+	err := c.copyObject(ctx, src, name, srcKey, dstKey, sse)
+	if sse && c.SSEType == "" && isSSEUnsupported(err) {
+		c.log("S3 Cache Migrate %s server-side encryption not supported, retrying without", dstKey)
+		c.disableSSE()
+		return c.copyObject(ctx, src, name, srcKey, dstKey, false)
+	}
+	return err
+}
+
+func (c *Cache) copyObject(ctx context.Context, src *Cache, name, srcKey, dstKey string, sse bool) error {
+	svc, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	// The settings are collected like for a Put and then transferred.
+	settings := &s3.PutObjectInput{}
+	if err := c.setSSE(ctx, settings, name, sse); err != nil {
+		return err
+	}
+	if err := c.setStorageClass(settings, name); err != nil {
+		return err
+	}
+	if err := c.setACL(settings); err != nil {
+		return err
+	}
+	if err := c.setObjectLock(settings); err != nil {
+		return err
+	}
+	if err := c.setTagging(settings); err != nil {
+		return err
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:                    aws.String(c.bucket),
+		Key:                       aws.String(dstKey),
+		CopySource:                aws.String(copySource(src.bucket, srcKey)),
+		ExpectedBucketOwner:       optionalString(c.ExpectedBucketOwner),
+		ExpectedSourceBucketOwner: optionalString(src.ExpectedBucketOwner),
+		ServerSideEncryption:      settings.ServerSideEncryption,
+		SSEKMSKeyId:               settings.SSEKMSKeyId,
+		SSEKMSEncryptionContext:   settings.SSEKMSEncryptionContext,
+		StorageClass:              settings.StorageClass,
+		ACL:                       settings.ACL,
+		ObjectLockMode:            settings.ObjectLockMode,
+		ObjectLockRetainUntilDate: settings.ObjectLockRetainUntilDate,
+	}
+	if settings.Tagging != nil {
+		input.Tagging = settings.Tagging
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+	}
+	_, err = svc.CopyObjectWithContext(ctx, input)
+	return err
+}
+
+// copySource returns the URL-encoded CopySource of key in bucket. S3 decodes a
+// "+" in it to a space, so that is encoded as well.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.PathEscape(segment), "+", "%2B", -1)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+func (c *Cache) transformsKeys() bool {
+	return c.HashKeys || c.KeySecret != nil || c.KeyFunc != nil || c.KeyTemplate != ""
+}
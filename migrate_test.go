@@ -0,0 +1,113 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// copyingS3 implements CopyObject within a testS3, ignoring buckets.
+type copyingS3 struct {
+	*testS3
+	copies []*s3.CopyObjectInput
+}
+
+func (s *copyingS3) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	s.copies = append(s.copies, input)
+
+	source := strings.SplitN(aws.StringValue(input.CopySource), "/", 2)
+	key, err := url.PathUnescape(source[1])
+	if err != nil {
+		return nil, err
+	}
+	b, ok := s.cache[key]
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), http.StatusNotFound, "")
+	}
+	s.cache[*input.Key] = b
+	s.meta[*input.Key] = s.meta[key]
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func TestMigrate(t *testing.T) {
+	data := bytes.Repeat([]byte("-----BEGIN CERTIFICATE-----\n"), 10)
+	srcS3 := &testS3{cache: map[string][]byte{
+		"old/a":             data,
+		"old/b":             {2},
+		"old/a/versions/00": {3},
+		"other/c":           {4},
+	}}
+	dstS3 := &testS3{cache: map[string][]byte{}}
+	src := &Cache{s3: srcS3, Prefix: "old/"}
+	dst := &Cache{s3: dstS3, Prefix: "new/", Compress: true}
+	ctx := context.Background()
+
+	assert.NoError(t, Migrate(ctx, src, dst))
+	assert.Len(t, dstS3.cache, 2)
+	assert.True(t, bytes.HasPrefix(dstS3.cache["new/a"], gzipMagic))
+	assert.True(t, bytes.HasPrefix(dstS3.cache["new/b"], gzipMagic))
+
+	b, err := dst.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestMigrateErrors(t *testing.T) {
+	srcS3 := &testS3{cache: map[string][]byte{"a": {1}, "b": {2}}}
+	dstS3 := &testS3{cache: map[string][]byte{}}
+	src := &Cache{s3: srcS3}
+	dst := &Cache{s3: &failingPutS3{testS3: dstS3, fail: "new/b"}, Prefix: "new/"}
+
+	err := Migrate(context.Background(), src, dst)
+	var migrateErr *MultiError
+	if assert.True(t, errors.As(err, &migrateErr)) {
+		assert.Equal(t, map[string]error{"b": errTestPut}, migrateErr.Errors)
+	}
+	assert.EqualError(t, err, "s3cache: migrating 1 keys failed: b: put failed")
+	assert.True(t, errors.Is(err, errTestPut))
+	assert.Equal(t, map[string][]byte{"new/a": {1}}, dstS3.cache)
+
+	assert.Equal(t, errMigrateHashedKeys, Migrate(context.Background(), &Cache{HashKeys: true}, dst))
+	assert.Equal(t, ErrReadOnly, Migrate(context.Background(), src, &Cache{ReadOnly: true}))
+}
+
+func TestMigrateCopyObject(t *testing.T) {
+	testS3Cache := &copyingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	src := &Cache{bucket: "old-bucket", s3: testS3Cache, Prefix: "old/", VerifyChecksum: true}
+	dst := &Cache{bucket: "new-bucket", s3: testS3Cache, Prefix: "new/", StorageClass: s3.StorageClassStandardIa}
+	ctx := context.Background()
+
+	assert.NoError(t, src.Put(ctx, "acme_account+key", []byte{1}))
+	assert.NoError(t, Migrate(ctx, src, dst))
+	if assert.Len(t, testS3Cache.copies, 1) {
+		input := testS3Cache.copies[0]
+		assert.Equal(t, "old-bucket/old/acme_account%2Bkey", aws.StringValue(input.CopySource))
+		assert.Equal(t, "new/acme_account+key", aws.StringValue(input.Key))
+		assert.Equal(t, s3.StorageClassStandardIa, aws.StringValue(input.StorageClass))
+		assert.Equal(t, s3.ServerSideEncryptionAes256, aws.StringValue(input.ServerSideEncryption))
+	}
+	assert.NotNil(t, testS3Cache.meta["new/acme_account+key"][checksumMetadataKey])
+
+	b, err := dst.Get(ctx, "acme_account+key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	// Settings CopyObject can't apply fall back to Get and Put.
+	testS3Cache.copies = nil
+	dst.Compress = true
+	assert.NoError(t, Migrate(ctx, src, dst))
+	assert.Empty(t, testS3Cache.copies)
+	assert.True(t, bytes.HasPrefix(testS3Cache.cache["new/acme_account+key"], gzipMagic))
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MultiError is returned by bulk operations like DeleteMany and Migrate if
+// some keys failed. The other keys succeeded. errors.Is and errors.As find
+// the error of any key.
+type MultiError struct {
+	// Op describes the operation, e.g. "deleting".
+	Op string
+	// Errors holds the error of every key that failed.
+	Errors map[string]error
+}
+
+func (e *MultiError) Error() string {
+	keys := e.keys()
+	msgs := make([]string, len(keys))
+	for i, key := range keys {
+		msgs[i] = fmt.Sprintf("%s: %v", key, e.Errors[key])
+	}
+	return fmt.Sprintf("s3cache: %s %d keys failed: %s", e.Op, len(keys), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of all keys, sorted by key.
+func (e *MultiError) Unwrap() []error {
+	keys := e.keys()
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = e.Errors[key]
+	}
+	return errs
+}
+
+func (e *MultiError) keys() []string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// errObjectLockIncomplete is returned by Put if only one of ObjectLockMode
+// and ObjectLockRetention is set.
+var errObjectLockIncomplete = errors.New("s3cache: ObjectLockMode and ObjectLockRetention must be set together")
+
+// setObjectLock sets the object lock of ObjectLockMode and
+// ObjectLockRetention on input.
+func (c *Cache) setObjectLock(input *s3.PutObjectInput) error {
+	if c.ObjectLockMode == "" && c.ObjectLockRetention == 0 {
+		return nil
+	}
+	if c.ObjectLockMode == "" || c.ObjectLockRetention <= 0 {
+		return errObjectLockIncomplete
+	}
+
+	for _, v := range s3.ObjectLockMode_Values() {
+		if c.ObjectLockMode == v {
+			input.ObjectLockMode = aws.String(c.ObjectLockMode)
+			input.ObjectLockRetainUntilDate = aws.Time(time.Now().Add(c.ObjectLockRetention))
+			return nil
+		}
+	}
+	return fmt.Errorf("s3cache: unknown object lock mode %q", c.ObjectLockMode)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheObjectLock(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Nil(t, testS3Cache.inputs["dummy"].ObjectLockMode)
+	assert.Nil(t, testS3Cache.inputs["dummy"].ObjectLockRetainUntilDate)
+
+	cache.ObjectLockMode = s3.ObjectLockModeCompliance
+	cache.ObjectLockRetention = 24 * time.Hour
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{2}))
+	assert.Equal(t, s3.ObjectLockModeCompliance, aws.StringValue(testS3Cache.inputs["dummy"].ObjectLockMode))
+	until := aws.TimeValue(testS3Cache.inputs["dummy"].ObjectLockRetainUntilDate)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), until, time.Minute)
+}
+
+func TestCacheObjectLockInvalid(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	ctx := context.Background()
+
+	cache := &Cache{s3: testS3Cache, ObjectLockMode: s3.ObjectLockModeGovernance}
+	assert.Equal(t, errObjectLockIncomplete, cache.Put(ctx, "dummy", []byte{1}))
+
+	cache = &Cache{s3: testS3Cache, ObjectLockRetention: time.Hour}
+	assert.Equal(t, errObjectLockIncomplete, cache.Put(ctx, "dummy", []byte{1}))
+
+	cache = &Cache{s3: testS3Cache, ObjectLockMode: "FOREVER", ObjectLockRetention: time.Hour}
+	assert.EqualError(t, cache.Put(ctx, "dummy", []byte{1}), `s3cache: unknown object lock mode "FOREVER"`)
+
+	assert.Empty(t, testS3Cache.cache)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// Option configures a Cache created by New or NewWithConfig.
+type Option func(*options)
+
+type options struct {
+	lazyInit         bool
+	timeouts         *Timeouts
+	bucketValidation BucketValidation
+	dualStack        bool
+	endpoint         string
+	pathStyle        bool
+	keepAlive        time.Duration
+	cdn              *CDN
+	assumeRole       *AssumeRole
+	keyTemplate      string
+	sse              *SSE
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *options) apply(config *aws.Config) {
+	if o.timeouts != nil {
+		config.HTTPClient = o.timeouts.httpClient()
+	}
+	if o.dualStack {
+		config.UseDualStackEndpoint = endpoints.DualStackEndpointStateEnabled
+	}
+	if o.endpoint != "" {
+		config.Endpoint = aws.String(o.endpoint)
+	}
+	if o.pathStyle {
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+}
+
+// WithLazyInit defers creating the AWS session and S3 client until the first
+// operation on the Cache, which then pays the cost. Errors that would have
+// been returned by New are returned by that operation instead.
+func WithLazyInit(lazy bool) Option {
+	return func(o *options) {
+		o.lazyInit = lazy
+	}
+}
+
+// WithBucketValidation sets how strictly New validates the bucket name.
+// By default, the S3 bucket naming rules are enforced.
+func WithBucketValidation(v BucketValidation) Option {
+	return func(o *options) {
+		o.bucketValidation = v
+	}
+}
+
+// WithKeyTemplate sets the KeyTemplate of the Cache. Unlike setting the field,
+// New validates the template and returns an error if it is invalid.
+func WithKeyTemplate(template string) Option {
+	return func(o *options) {
+		o.keyTemplate = template
+	}
+}
+
+// WithSSE sets the SSEType, KMSKeyID and EncryptionContext of the Cache.
+// Unlike setting the fields, New validates them and returns an error if
+// they are inconsistent, e.g. a KMSKeyID without SSE-KMS.
+func WithSSE(sse SSE) Option {
+	return func(o *options) {
+		o.sse = &sse
+	}
+}
+
+// Timeouts bound the individual phases of every HTTP request made to S3.
+// A zero duration leaves the respective phase unbounded.
+//
+// These apply per HTTP request, so each retry by the SDK gets the full
+// budget again. A context deadline passed to an operation is enforced in
+// addition to these; whichever expires first aborts the request.
+type Timeouts struct {
+	// Dial limits establishing the TCP connection.
+	Dial time.Duration
+	// TLSHandshake limits the TLS handshake after the connection is established.
+	TLSHandshake time.Duration
+	// ResponseHeader limits waiting for the response headers after the
+	// request has been written.
+	ResponseHeader time.Duration
+	// Request limits the whole request including reading the response body.
+	Request time.Duration
+}
+
+func (t *Timeouts) httpClient() *http.Client {
+	return &http.Client{
+		Timeout: t.Request,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   t.Dial,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   t.TLSHandshake,
+			ResponseHeaderTimeout: t.ResponseHeader,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+// WithTimeouts makes New use an HTTP client with the specified timeouts.
+func WithTimeouts(t Timeouts) Option {
+	return func(o *options) {
+		o.timeouts = &t
+	}
+}
+
+// WithDualStack makes New use the dual-stack (IPv4 and IPv6) S3 endpoints,
+// which is required on IPv6-only hosts. Not every region offers dual-stack
+// endpoints; see the AWS documentation for the regions that do.
+func WithDualStack(dualStack bool) Option {
+	return func(o *options) {
+		o.dualStack = dualStack
+	}
+}
+
+// WithEndpoint makes New use a custom endpoint instead of AWS, e.g.
+// "https://minio.example.org:9000" for MinIO, Ceph RGW or DigitalOcean
+// Spaces. Most of these also need WithPathStyle.
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithPathStyle makes New address the bucket in the path of the URL
+// (endpoint/bucket/key) instead of the host name (bucket.endpoint/key).
+func WithPathStyle(pathStyle bool) Option {
+	return func(o *options) {
+		o.pathStyle = pathStyle
+	}
+}
+
+// WithKeepAlive makes the Cache issue a HeadObject for a non-existent key
+// every interval, so that an idle host keeps a warm connection to S3 and the
+// first handshake after a quiet period doesn't pay for connecting to S3.
+// Every request is billed like any other HeadObject. Call Close to stop it.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = interval
+	}
+}
+
+// WithCDN makes Get read objects through a CDN, see CDN.
+func WithCDN(cdn CDN) Option {
+	return func(o *options) {
+		o.cdn = &cdn
+	}
+}
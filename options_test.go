@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func stubSession(err error) (calls *int, restore func()) {
+	calls, _, restore = stubSessionConfig(err)
+	return calls, restore
+}
+
+func stubSessionConfig(err error) (calls *int, config *aws.Config, restore func()) {
+	calls, config = new(int), &aws.Config{}
+	newSession = func(cfgs ...*aws.Config) (*session.Session, error) {
+		*calls++
+		config.MergeIn(cfgs...)
+		return nil, err
+	}
+	return calls, config, func() {
+		newSession = session.NewSession
+	}
+}
+
+func TestWithLazyInit(t *testing.T) {
+	errSession := errors.New("session")
+	calls, restore := stubSession(errSession)
+	defer restore()
+	ctx := context.Background()
+
+	cache, err := New("eu-west-1", "my-bucket", WithLazyInit(true))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, *calls)
+
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, errSession, err)
+	assert.Equal(t, 1, *calls)
+
+	assert.Equal(t, errSession, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, 1, *calls)
+}
+
+func TestWithoutLazyInit(t *testing.T) {
+	errSession := errors.New("session")
+	calls, restore := stubSession(errSession)
+	defer restore()
+
+	_, err := New("eu-west-1", "my-bucket")
+	assert.Equal(t, errSession, err)
+	assert.Equal(t, 1, *calls)
+}
+
+func TestWithTimeouts(t *testing.T) {
+	// The listener accepts connections but never answers the TLS handshake.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	o := newOptions([]Option{WithTimeouts(Timeouts{
+		Dial:         time.Second,
+		TLSHandshake: 50 * time.Millisecond,
+		Request:      5 * time.Second,
+	})})
+
+	start := time.Now()
+	_, err = o.timeouts.httpClient().Get("https://" + ln.Addr().String())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS handshake timeout")
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestWithTimeoutsDial(t *testing.T) {
+	o := newOptions([]Option{WithTimeouts(Timeouts{Dial: time.Nanosecond})})
+
+	_, err := o.timeouts.httpClient().Get("http://127.0.0.1:1")
+	if assert.Error(t, err) {
+		netErr, ok := errors.Unwrap(err).(net.Error)
+		assert.True(t, ok && netErr.Timeout())
+	}
+}
+
+func TestWithDualStack(t *testing.T) {
+	_, config, restore := stubSessionConfig(errors.New("session"))
+	defer restore()
+
+	New("eu-west-1", "my-bucket")
+	assert.Equal(t, endpoints.DualStackEndpointStateUnset, config.UseDualStackEndpoint)
+
+	New("eu-west-1", "my-bucket", WithDualStack(true))
+	assert.Equal(t, endpoints.DualStackEndpointStateEnabled, config.UseDualStackEndpoint)
+}
+
+func TestNewWithConfig(t *testing.T) {
+	_, config, restore := stubSessionConfig(errors.New("session"))
+	defer restore()
+
+	creds := credentials.NewStaticCredentials("id", "secret", "")
+	cfg := &aws.Config{Region: aws.String("eu-central-1"), Credentials: creds}
+	NewWithConfig(cfg, "my-bucket", WithEndpoint("https://minio.example.org:9000"))
+	assert.Equal(t, "eu-central-1", aws.StringValue(config.Region))
+	assert.Equal(t, creds, config.Credentials)
+	assert.Equal(t, "https://minio.example.org:9000", aws.StringValue(config.Endpoint))
+	assert.Nil(t, cfg.Endpoint)
+
+	_, err := NewWithConfig(cfg, "My_Bucket")
+	assert.Error(t, err)
+}
+
+func TestWithEndpoint(t *testing.T) {
+	_, config, restore := stubSessionConfig(errors.New("session"))
+	defer restore()
+
+	New("eu-west-1", "my-bucket")
+	assert.Nil(t, config.Endpoint)
+	assert.Nil(t, config.S3ForcePathStyle)
+
+	New("us-east-1", "my-bucket", WithEndpoint("https://minio.example.org:9000"), WithPathStyle(true))
+	assert.Equal(t, "https://minio.example.org:9000", aws.StringValue(config.Endpoint))
+	assert.True(t, aws.BoolValue(config.S3ForcePathStyle))
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxRedirectBody limits how much of the body of a redirect is read for its
+// endpoint.
+const maxRedirectBody = 64 << 10
+
+// RedirectError is returned when S3, or a gateway in front of it, answers a
+// request with a redirect. It names the target of the redirect, so that the
+// Cache can be created for it.
+//
+// Redirects are not followed. Go's http.Client follows a 307 with a Location
+// header for GET and HEAD, but it drops the signature on another host, and
+// the signature does not cover another path. Signing the request again for
+// the Location would send signatures derived from the credentials to any
+// host a gateway names, so only redirects that reach the SDK, like the 301
+// S3 sends for a bucket in another region, become a RedirectError.
+//
+// A RedirectError is an awserr.RequestFailure with the code and status of
+// the response. Clients created by New, NewWithConfig and NewWithProvider
+// return it; NewWithS3 leaves the handlers of its client alone.
+type RedirectError struct {
+	awserr.RequestFailure
+	// Region is the region of the bucket from the x-amz-bucket-region
+	// header, if any.
+	Region string
+	// Endpoint is the endpoint to send requests for the bucket to, from the
+	// error document, if any.
+	Endpoint string
+	// Location is the Location header of the response, if any.
+	Location string
+}
+
+func (e *RedirectError) Error() string {
+	var target []string
+	if e.Region != "" {
+		target = append(target, "region "+e.Region)
+	}
+	if e.Endpoint != "" {
+		target = append(target, "endpoint "+e.Endpoint)
+	}
+	if e.Location != "" {
+		target = append(target, "location "+e.Location)
+	}
+
+	msg := fmt.Sprintf("redirected with %d %s", e.StatusCode(), http.StatusText(e.StatusCode()))
+	if len(target) > 0 {
+		msg += " to " + strings.Join(target, ", ")
+	}
+	return msg + ": " + e.RequestFailure.Error()
+}
+
+func (e *RedirectError) Unwrap() error {
+	return e.RequestFailure
+}
+
+// redirectBody keeps the endpoint of a redirect after the SDK consumed and
+// closed the body.
+type redirectBody struct {
+	io.Reader
+	endpoint string
+}
+
+func (b *redirectBody) Close() error {
+	return nil
+}
+
+// withRedirectErrors makes svc return a RedirectError for redirects.
+func withRedirectErrors(svc *s3.S3) *s3.S3 {
+	svc.Handlers.UnmarshalError.PushFrontNamed(request.NamedHandler{
+		Name: "s3cache.readRedirect",
+		Fn:   readRedirect,
+	})
+	svc.Handlers.UnmarshalError.PushBackNamed(request.NamedHandler{
+		Name: "s3cache.redirectError",
+		Fn:   redirectError,
+	})
+	return svc
+}
+
+// readRedirect reads the endpoint from the error document of a redirect,
+// before the SDK unmarshals, or for a 301 discards, the body.
+func readRedirect(r *request.Request) {
+	if !isRedirect(r.HTTPResponse) {
+		return
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(r.HTTPResponse.Body, maxRedirectBody))
+	r.HTTPResponse.Body.Close()
+
+	var doc struct {
+		Endpoint string `xml:"Endpoint"`
+	}
+	xml.Unmarshal(b, &doc)
+	r.HTTPResponse.Body = &redirectBody{Reader: bytes.NewReader(b), endpoint: doc.Endpoint}
+}
+
+// redirectError wraps the error the SDK unmarshaled for a redirect.
+func redirectError(r *request.Request) {
+	if !isRedirect(r.HTTPResponse) {
+		return
+	}
+	reqErr, ok := r.Error.(awserr.RequestFailure)
+	if !ok {
+		return
+	}
+
+	e := &RedirectError{
+		RequestFailure: reqErr,
+		Region:         r.HTTPResponse.Header.Get("x-amz-bucket-region"),
+		Location:       r.HTTPResponse.Header.Get("Location"),
+	}
+	if b, ok := r.HTTPResponse.Body.(*redirectBody); ok {
+		e.Endpoint = b.endpoint
+	}
+	r.Error = e
+}
+
+func isRedirect(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode >= 300 && resp.StatusCode < 400 && resp.StatusCode != http.StatusNotModified
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRedirectingCache(t *testing.T, handler http.HandlerFunc) *Cache {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cache, err := NewWithConfig(&aws.Config{
+		Region:           aws.String("eu-west-1"),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		HTTPClient: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}, "my-bucket")
+	assert.NoError(t, err)
+	return cache
+}
+
+func TestCacheRedirectError(t *testing.T) {
+	cache := newRedirectingCache(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "https://gateway.example.org/my-bucket/dummy")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+		w.Write([]byte(`<Error><Code>TemporaryRedirect</Code><Message>Please re-send this request to the specified temporary endpoint.</Message><Endpoint>gateway.example.org</Endpoint></Error>`))
+	})
+
+	_, err := cache.Get(context.Background(), "dummy")
+	var redirectErr *RedirectError
+	if assert.True(t, errors.As(err, &redirectErr)) {
+		assert.Equal(t, "TemporaryRedirect", redirectErr.Code())
+		assert.Equal(t, http.StatusTemporaryRedirect, redirectErr.StatusCode())
+		assert.Empty(t, redirectErr.Region)
+		assert.Equal(t, "gateway.example.org", redirectErr.Endpoint)
+		assert.Equal(t, "https://gateway.example.org/my-bucket/dummy", redirectErr.Location)
+	}
+	assert.Contains(t, err.Error(), "s3cache: get dummy: redirected with 307 Temporary Redirect to endpoint gateway.example.org, location https://gateway.example.org/my-bucket/dummy: TemporaryRedirect")
+}
+
+func TestCacheRedirectRegionError(t *testing.T) {
+	defer stubBucketRegion("", errors.New("lookup not expected"))()
+
+	cache := newRedirectingCache(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-bucket-region", "us-west-2")
+		w.WriteHeader(http.StatusMovedPermanently)
+		w.Write([]byte(`<Error><Code>PermanentRedirect</Code><Endpoint>my-bucket.s3.us-west-2.amazonaws.com</Endpoint></Error>`))
+	})
+
+	err := cache.Put(context.Background(), "dummy", []byte{1})
+	var regionErr *RegionError
+	if assert.True(t, errors.As(err, &regionErr)) {
+		assert.Equal(t, "us-west-2", regionErr.Region)
+	}
+	var redirectErr *RedirectError
+	if assert.True(t, errors.As(err, &redirectErr)) {
+		assert.Equal(t, bucketRegionErrorCode, redirectErr.Code())
+		assert.Equal(t, "my-bucket.s3.us-west-2.amazonaws.com", redirectErr.Endpoint)
+	}
+}
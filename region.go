@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// bucketRegionErrorCode is the code of the error the SDK returns when S3
+// redirects a request because the bucket is in another region.
+const bucketRegionErrorCode = "BucketRegionError"
+
+// bucketRegion is replaced in tests.
+var bucketRegion = s3manager.GetBucketRegionWithClient
+
+// RegionError is returned when the bucket is not in the region the Cache
+// was created for. Create the Cache for Region instead.
+type RegionError struct {
+	Bucket string
+	// Region is the region the bucket is in.
+	Region string
+	// Err is the error returned by S3.
+	Err error
+}
+
+func (e *RegionError) Error() string {
+	return fmt.Sprintf("s3cache: bucket %s is in region %s, use that region instead", e.Bucket, e.Region)
+}
+
+func (e *RegionError) Unwrap() error {
+	return e.Err
+}
+
+// regionError looks up the region of the bucket after S3 rejected a request
+// with err for going to the wrong region, unless the redirect named it. It
+// returns nil if the region could not be found out.
+func (c *Cache) regionError(ctx context.Context, err error) error {
+	var redirectErr *RedirectError
+	if errors.As(err, &redirectErr) && redirectErr.Region != "" {
+		return &RegionError{Bucket: c.bucket, Region: redirectErr.Region, Err: err}
+	}
+
+	svc, cerr := c.client()
+	if cerr != nil {
+		return nil
+	}
+
+	region, rerr := bucketRegion(ctx, svc, c.bucket)
+	if rerr != nil {
+		c.log("S3 Cache looking up the region of bucket %s failed: %v", c.bucket, rerr)
+		return nil
+	}
+	return &RegionError{Bucket: c.bucket, Region: region, Err: err}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+)
+
+func stubBucketRegion(region string, err error) (restore func()) {
+	bucketRegion = func(ctx aws.Context, svc s3iface.S3API, bucket string, opts ...request.Option) (string, error) {
+		return region, err
+	}
+	return func() {
+		bucketRegion = s3manager.GetBucketRegionWithClient
+	}
+}
+
+func TestCacheRegionError(t *testing.T) {
+	defer stubBucketRegion("us-west-2", nil)()
+
+	redirect := awserr.NewRequestFailure(awserr.New(bucketRegionErrorCode, "incorrect region, the bucket is not in 'eu-west-1' region", nil), http.StatusMovedPermanently, "")
+	cache := &Cache{bucket: "my-bucket", s3: &erroringS3{testS3: &testS3{}, err: redirect}}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "dummy")
+	var regionErr *RegionError
+	if assert.True(t, errors.As(err, &regionErr)) {
+		assert.Equal(t, "my-bucket", regionErr.Bucket)
+		assert.Equal(t, "us-west-2", regionErr.Region)
+		assert.Equal(t, redirect, regionErr.Err)
+	}
+	assert.EqualError(t, cache.Put(ctx, "dummy", []byte{1}), "s3cache: bucket my-bucket is in region us-west-2, use that region instead")
+}
+
+func TestCacheRegionErrorUnknown(t *testing.T) {
+	defer stubBucketRegion("", errors.New("lookup failed"))()
+
+	redirect := awserr.NewRequestFailure(awserr.New(bucketRegionErrorCode, "incorrect region", nil), http.StatusMovedPermanently, "")
+	cache := &Cache{bucket: "my-bucket", s3: &erroringS3{testS3: &testS3{}, err: redirect}}
+
+	assert.EqualError(t, cache.Delete(context.Background(), "dummy"), "s3cache: delete dummy: "+redirect.Error())
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// Replica is a copy of the Cache's bucket that Get reads from, e.g. a bucket
+// in a region closer to the host that S3 Replication copies the bucket to.
+// Put and Delete always go to the Cache's bucket. If reading the replica
+// fails, Get falls back to the Cache's bucket.
+//
+// ExpectedBucketOwner applies to the replica as well.
+type Replica struct {
+	// S3 is the client for the region of the replica.
+	S3 s3iface.S3API
+	// Bucket is the name of the replica bucket.
+	Bucket string
+	// ReadPrimaryOnMiss makes Get read the Cache's bucket if an object is
+	// not found in the replica. Replication is asynchronous, so a freshly
+	// written certificate may be missing from the replica for a while.
+	// Without this, Get returns autocert.ErrCacheMiss right away, which costs
+	// no extra request for keys that really don't exist.
+	ReadPrimaryOnMiss bool
+}
+
+func (c *Cache) readReplica(ctx context.Context, key string) (data []byte, err error) {
+	err = c.retrying(ctx, func() (err error) {
+		data, err = c.getFrom(ctx, c.Replica.S3, c.Replica.Bucket, key)
+		return err
+	})
+	return data, err
+}
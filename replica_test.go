@@ -0,0 +1,49 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCacheReplica(t *testing.T) {
+	primary := &testS3{cache: map[string][]byte{"a": {1}, "b": {2}}}
+	replica := &testS3{cache: map[string][]byte{"a": {3}}}
+	cache := &Cache{s3: primary, Replica: &Replica{S3: replica, Bucket: "my-replica"}, MissTTL: -1}
+	ctx := context.Background()
+
+	b, err := cache.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{3}, b)
+
+	_, err = cache.Get(ctx, "b")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	cache.Replica.ReadPrimaryOnMiss = true
+	b, err = cache.Get(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+
+	assert.NoError(t, cache.Put(ctx, "c", []byte{4}))
+	assert.NoError(t, cache.Delete(ctx, "a"))
+	assert.Equal(t, map[string][]byte{"b": {2}, "c": {4}}, primary.cache)
+	assert.Equal(t, map[string][]byte{"a": {3}}, replica.cache)
+}
+
+func TestCacheReplicaFailing(t *testing.T) {
+	failing := &erroringS3{testS3: &testS3{}, err: awserr.NewRequestFailure(awserr.New("InvalidRequest", "Invalid Request", nil), http.StatusBadRequest, "")}
+	cache := &Cache{
+		s3:      &testS3{cache: map[string][]byte{"a": {1}}},
+		Replica: &Replica{S3: failing, Bucket: "my-replica"},
+	}
+
+	b, err := cache.Get(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+}
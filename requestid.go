@@ -0,0 +1,38 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// RequestID returns the request ID (x-amz-request-id) and the extended
+// request ID (x-amz-id-2) of the failed S3 request err originates from, as
+// AWS support asks for them. Errors returned by S3 are wrapped by the Cache,
+// so these are found as well. Both are empty if err carries none.
+//
+// Errors mapped to autocert.ErrCacheMiss or ErrAccessDenied carry no IDs.
+// Access denials are logged with them instead.
+func RequestID(err error) (requestID, extendedRequestID string) {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return "", ""
+	}
+
+	requestID = reqErr.RequestID()
+	if s3Err, ok := reqErr.(s3.RequestFailure); ok {
+		extendedRequestID = s3Err.HostID()
+	}
+	return requestID, extendedRequestID
+}
+
+// accessDenied logs err, which S3 denied, with its request IDs before they
+// are lost by returning ErrAccessDenied.
+func (c *Cache) accessDenied(op, key string, err error) error {
+	requestID, extendedRequestID := RequestID(err)
+	c.logError("S3 Cache %s %s access denied (request id: %s, extended request id: %s)", op, key, requestID, extendedRequestID)
+	return ErrAccessDenied
+}
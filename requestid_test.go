@@ -0,0 +1,54 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+// testS3RequestFailure mimics the errors of the S3 client, which carry the
+// extended request ID as host ID.
+type testS3RequestFailure struct {
+	awserr.RequestFailure
+	hostID string
+}
+
+func (f testS3RequestFailure) HostID() string {
+	return f.hostID
+}
+
+func TestRequestID(t *testing.T) {
+	invalid := testS3RequestFailure{
+		RequestFailure: awserr.NewRequestFailure(awserr.New("InvalidRequest", "Invalid Request", nil), http.StatusBadRequest, "REQ123"),
+		hostID:         "HOST456",
+	}
+	cache := &Cache{s3: &erroringS3{testS3: &testS3{}, err: invalid}}
+
+	_, err := cache.Get(context.Background(), "dummy")
+	requestID, extendedRequestID := RequestID(err)
+	assert.Equal(t, "REQ123", requestID)
+	assert.Equal(t, "HOST456", extendedRequestID)
+
+	requestID, extendedRequestID = RequestID(awserr.NewRequestFailure(awserr.New("InvalidRequest", "Invalid Request", nil), http.StatusBadRequest, "REQ789"))
+	assert.Equal(t, "REQ789", requestID)
+	assert.Empty(t, extendedRequestID)
+
+	requestID, extendedRequestID = RequestID(errors.New("test"))
+	assert.Empty(t, requestID)
+	assert.Empty(t, extendedRequestID)
+}
+
+func TestRequestIDAccessDeniedLogged(t *testing.T) {
+	l := &testLevelLogger{}
+	denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "REQ123")
+	cache := &Cache{s3: &erroringS3{testS3: &testS3{}, err: denied}, Logger: l}
+
+	assert.Equal(t, ErrAccessDenied, cache.Delete(context.Background(), "dummy"))
+	assert.Contains(t, l.errors, "S3 Cache Delete dummy access denied (request id: REQ123, extended request id: )")
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// defaultRetryBaseDelay is used if RetryBaseDelay is not set.
+const defaultRetryBaseDelay = 100 * time.Millisecond
+
+// defaultContentionRetryDelay is used if ContentionRetryDelay is not set.
+const defaultContentionRetryDelay = 10 * time.Millisecond
+
+// slowDownCode is returned with a 503 while S3 throttles requests. The SDK
+// does not know it as a throttling code.
+const slowDownCode = "SlowDown"
+
+// operationAbortedCode is returned with a 409 while a conflicting conditional
+// operation on the same bucket or object is in progress.
+const operationAbortedCode = "OperationAborted"
+
+// DefaultRetryableCodes are the error codes retried if RetryableCodes is nil.
+var DefaultRetryableCodes = []string{slowDownCode, operationAbortedCode}
+
+// retrying calls fn and retries it up to MaxRetries times while it fails with
+// a transient error. Before each retry it waits a random duration of up to
+// RetryBaseDelay, or ContentionRetryDelay for contention, doubled for every
+// retry, or until ctx is done.
+func (c *Cache) retrying(ctx context.Context, fn func() error) error {
+	err := fn()
+	for i := 0; i < c.MaxRetries && c.isRetryable(err); i++ {
+		delay := time.Duration(rand.Int63n(int64(c.retryDelay(err) << uint(i))))
+		c.log("S3 Cache retrying in %s after: %v", delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = fn()
+	}
+	return err
+}
+
+// retryDelay returns the maximum delay before the first retry of err.
+func (c *Cache) retryDelay(err error) time.Duration {
+	if hasErrorCode(err, operationAbortedCode) {
+		if c.ContentionRetryDelay > 0 {
+			return c.ContentionRetryDelay
+		}
+		return defaultContentionRetryDelay
+	}
+	if c.RetryBaseDelay > 0 {
+		return c.RetryBaseDelay
+	}
+	return defaultRetryBaseDelay
+}
+
+// retryableCodes returns RetryableCodes, or DefaultRetryableCodes if nil.
+func (c *Cache) retryableCodes() []string {
+	if c.RetryableCodes == nil {
+		return DefaultRetryableCodes
+	}
+	return c.RetryableCodes
+}
+
+// isRetryable reports whether err is transient, i.e. S3 throttled the request
+// (503 SlowDown), failed internally, responded with one of RetryableCodes,
+// like 409 OperationAborted for a concurrent operation, or the connection
+// broke, including while reading the body (ErrTruncated). Otherwise only
+// errors of the SDK and the network are considered; errors of the package
+// itself, like ErrConflict, are never transient.
+func (c *Cache) isRetryable(err error) bool {
+	if errors.Is(err, ErrTruncated) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() >= http.StatusInternalServerError {
+		return true
+	}
+
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		return hasErrorCode(awsErr, c.retryableCodes()...) ||
+			request.IsErrorThrottle(awsErr) || request.IsErrorRetryable(awsErr)
+	}
+
+	var (
+		urlErr *url.Error
+		netErr net.Error
+	)
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return request.IsErrorRetryable(err)
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// throttlingS3 fails the first throttle GetObjects with a 503 SlowDown.
+type throttlingS3 struct {
+	*testS3
+	throttle int
+	gets     int
+}
+
+func (s *throttlingS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	s.gets++
+	if s.gets <= s.throttle {
+		return nil, awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), http.StatusServiceUnavailable, "")
+	}
+	return s.testS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheMaxRetries(t *testing.T) {
+	testS3Cache := &throttlingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}, throttle: 2}
+	cache := &Cache{s3: testS3Cache, MaxRetries: 2, RetryBaseDelay: time.Millisecond}
+	ctx := context.Background()
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.Equal(t, 3, testS3Cache.gets)
+
+	testS3Cache.gets, testS3Cache.throttle = 0, 3
+	_, err = cache.Get(ctx, "dummy")
+	assert.True(t, cache.isRetryable(err))
+	assert.Equal(t, 3, testS3Cache.gets)
+}
+
+// abortingS3 fails the first abort PutObjects with a 409 OperationAborted.
+type abortingS3 struct {
+	*testS3
+	abort int
+	puts  int
+}
+
+func (s *abortingS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	s.puts++
+	if s.puts <= s.abort {
+		return nil, awserr.NewRequestFailure(awserr.New("OperationAborted", "A conflicting conditional operation is currently in progress against this resource. Please try again.", nil), http.StatusConflict, "")
+	}
+	return s.testS3.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheMaxRetriesOperationAborted(t *testing.T) {
+	testS3Cache := &abortingS3{testS3: &testS3{cache: map[string][]byte{}}, abort: 1}
+	cache := &Cache{s3: testS3Cache, MaxRetries: 1, RetryBaseDelay: time.Millisecond}
+
+	assert.NoError(t, cache.Put(context.Background(), "dummy", []byte{1}))
+	assert.Equal(t, 2, testS3Cache.puts)
+	assert.Equal(t, []byte{1}, testS3Cache.cache["dummy"])
+}
+
+func TestCacheMaxRetriesOperationAbortedGeneration(t *testing.T) {
+	testS3Cache := &abortingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}, abort: 1}
+	cache := &Cache{
+		s3:                   testS3Cache,
+		TrackGeneration:      true,
+		MaxRetries:           1,
+		RetryBaseDelay:       time.Hour,
+		ContentionRetryDelay: time.Millisecond,
+	}
+
+	assert.NoError(t, cache.Put(context.Background(), "dummy", []byte{2}))
+	assert.Equal(t, 2, testS3Cache.puts)
+	assert.Equal(t, []byte{2}, testS3Cache.cache["dummy"])
+}
+
+func TestCacheRetryableCodes(t *testing.T) {
+	testS3Cache := &abortingS3{testS3: &testS3{cache: map[string][]byte{}}, abort: 1}
+	cache := &Cache{s3: testS3Cache, MaxRetries: 1, RetryableCodes: []string{}}
+
+	err := cache.Put(context.Background(), "dummy", []byte{1})
+	assert.True(t, hasErrorCode(err, operationAbortedCode))
+	assert.Equal(t, 1, testS3Cache.puts)
+
+	cache = &Cache{RetryableCodes: []string{"XMinioServerNotInitialized"}}
+	assert.True(t, cache.isRetryable(awserr.New("XMinioServerNotInitialized", "Server not initialized, please try again.", nil)))
+	assert.False(t, cache.isRetryable(awserr.New(operationAbortedCode, "", nil)))
+}
+
+func TestCacheMaxRetriesNotFound(t *testing.T) {
+	testS3Cache := &throttlingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, MaxRetries: 2, RetryBaseDelay: time.Millisecond}
+
+	_, err := cache.Get(context.Background(), "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, 1, testS3Cache.gets)
+}
+
+func TestCacheMaxRetriesContext(t *testing.T) {
+	testS3Cache := &throttlingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}, throttle: 1}
+	cache := &Cache{s3: testS3Cache, MaxRetries: 1, RetryBaseDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, testS3Cache.gets)
+}
+
+// countingPutS3 counts the PutObjects passed on to S3API.
+type countingPutS3 struct {
+	s3iface.S3API
+	puts int
+}
+
+func (c *countingPutS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	c.puts++
+	return c.S3API.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheMaxRetriesConflict(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"dummy": {1}}}
+	counting := &countingPutS3{S3API: &staleHeadS3{testS3: testS3Cache}}
+	cache := &Cache{s3: counting, TrackGeneration: true, MaxRetries: 2, RetryBaseDelay: time.Millisecond}
+
+	assert.Equal(t, ErrConflict, cache.Put(context.Background(), "dummy", []byte{2}))
+	assert.Equal(t, 1, counting.puts)
+	assert.Equal(t, []byte{1}, testS3Cache.cache["dummy"])
+}
+
+func TestCacheMaxRetriesVerifyFailed(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{}}, corrupt: 10 * criticalPutAttempts}
+	cache := &Cache{
+		s3:             testS3Cache,
+		CriticalKey:    func(key string) bool { return true },
+		MaxRetries:     2,
+		RetryBaseDelay: time.Millisecond,
+	}
+
+	assert.Equal(t, ErrVerifyFailed, cache.Put(context.Background(), "acme_account+key", []byte{1}))
+	assert.Equal(t, criticalPutAttempts, testS3Cache.puts)
+}
+
+// truncatingOnceS3 truncates the body of the first GetObject only.
+type truncatingOnceS3 struct {
+	*truncatingS3
+	gets int
+}
+
+func (s *truncatingOnceS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	s.gets++
+	if s.gets == 1 {
+		return s.truncatingS3.GetObjectWithContext(ctx, input, opts...)
+	}
+	return s.testS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheMaxRetriesTruncated(t *testing.T) {
+	testS3Cache := &truncatingOnceS3{truncatingS3: &truncatingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}}}
+	cache := &Cache{s3: testS3Cache, MaxRetries: 1, RetryBaseDelay: time.Millisecond}
+
+	b, err := cache.Get(context.Background(), "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.Equal(t, 2, testS3Cache.gets)
+}
+
+func TestIsRetryable(t *testing.T) {
+	cache := &Cache{}
+	assert.True(t, cache.isRetryable(awserr.NewRequestFailure(awserr.New("InternalError", "We encountered an internal error.", nil), http.StatusInternalServerError, "")))
+	assert.True(t, cache.isRetryable(fmt.Errorf("s3cache: get dummy: %w", awserr.New("SlowDown", "Please reduce your request rate.", nil))))
+	assert.True(t, cache.isRetryable(&url.Error{Op: "Get", URL: "https://s3.amazonaws.com", Err: errors.New("connection reset by peer")}))
+	assert.True(t, cache.isRetryable(ErrTruncated))
+	assert.True(t, cache.isRetryable(fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF)))
+	assert.False(t, cache.isRetryable(awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")))
+	assert.False(t, cache.isRetryable(ErrConflict))
+	assert.False(t, cache.isRetryable(ErrVerifyFailed))
+	assert.False(t, cache.isRetryable(ErrDecrypt))
+	assert.False(t, cache.isRetryable(errors.New("gzip: invalid header")))
+	assert.False(t, cache.isRetryable(nil))
+}
@@ -8,8 +8,18 @@ package s3cache
 import (
 	"bytes"
 	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -17,6 +27,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/danilobuerger/autocert-s3-cache/internal/objectkey"
 	"golang.org/x/crypto/acme/autocert"
 )
 
@@ -25,37 +36,485 @@ type Logger interface {
 	Printf(format string, v ...interface{})
 }
 
+// LevelLogger is a Logger that separates traces of every operation from
+// failures. If the Cache's Logger implements it, traces are logged with
+// Debugf and failures with Errorf; otherwise both are logged with Printf.
+type LevelLogger interface {
+	Logger
+	Debugf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// ErrAccessDenied is returned when S3 denies access to the bucket or object,
+// for example because of missing permissions or a mismatching ExpectedBucketOwner.
+// Note that S3 also denies reading a missing object if s3:ListBucket is not
+// granted, so a Get returning ErrAccessDenied points at a misconfiguration
+// rather than at a cache miss.
+var ErrAccessDenied = errors.New("s3cache: access denied")
+
+// ErrNoSuchBucket is returned when the bucket does not exist, e.g. because
+// its name is mistyped or it was deleted. HeadObject responses carry no
+// error code, so operations based on them cannot tell a missing bucket from
+// a missing object.
+var ErrNoSuchBucket = errors.New("s3cache: bucket does not exist")
+
+// ErrVerifyFailed is returned by Put if the data read back after writing a
+// critical key does not match the data written.
+var ErrVerifyFailed = errors.New("s3cache: verifying written data failed")
+
+// ErrTruncated is returned by Get if S3 returned less data than the object's
+// advertised content length. It is transient, so Get retries it up to
+// MaxRetries times.
+var ErrTruncated = errors.New("s3cache: object data truncated")
+
+// ErrChecksumMismatch is returned by Get if VerifyChecksum is set and the data
+// read does not match the checksum stored with the object.
+var ErrChecksumMismatch = errors.New("s3cache: object data does not match checksum")
+
+// ErrInvalidEnvironment is returned when RequireEnvironment is set without an
+// Environment, or when the Environment contains a slash.
+var ErrInvalidEnvironment = errors.New("s3cache: invalid environment")
+
+// ErrKeyNotAllowed is returned by Put if AllowKey rejects the key.
+var ErrKeyNotAllowed = errors.New("s3cache: key not allowed")
+
+// ErrReadOnly is returned by every operation that would modify the bucket
+// while ReadOnly is set. No request is sent to S3.
+var ErrReadOnly = errors.New("s3cache: cache is read-only")
+
+// ErrClosed is returned by every operation on a Cache after Close.
+var ErrClosed = errors.New("s3cache: cache closed")
+
 // Making sure that we're adhering to the autocert.Cache interface.
 var _ autocert.Cache = (*Cache)(nil)
 
 // Cache provides a s3 backend to the autocert cache.
 type Cache struct {
-	// Prefix is used to prefix every objects key cached in s3.
+	// Prefix is used to prefix every objects key cached in s3. A
+	// PrefixSeparator is appended unless the prefix already ends with it,
+	// so "certs" and "certs/" both store keys like "certs/example.org".
+	//
+	// Deprecated: Changing Prefix while the cache is in use is a data race.
+	// Use SetPrefix instead, which takes precedence over this field.
 	Prefix string
-	// Logger is used for debug logging.
+	// PrefixSeparator is appended to a prefix not ending with it. Defaults
+	// to "/".
+	PrefixSeparator string
+	// RawPrefix uses the prefix as is, without appending PrefixSeparator.
+	// Set it if objects were stored under a prefix without a trailing
+	// separator before it was appended automatically.
+	RawPrefix bool
+	// Environment is inserted as a separate path segment between Prefix and
+	// the key of every object, e.g. Prefix + "prod/" + key. It must not
+	// contain slashes.
+	Environment string
+	// RequireEnvironment makes every operation fail with ErrInvalidEnvironment
+	// if Environment is not set, so that it can't be omitted by accident.
+	RequireEnvironment bool
+	// MultiTenant lets a single Cache serve several tenants sharing the
+	// bucket. Every operation reads the tenant from its context, see
+	// WithTenant, and inserts it as a separate path segment after the
+	// Environment, e.g. Prefix + "prod/" + tenant + "/" + key. Operations
+	// whose context lacks a tenant fail with ErrInvalidTenant.
+	MultiTenant bool
+	// CriticalKey reports whether a key is critical. A Put of a critical key
+	// reads the object back and compares it to the written data, rewriting
+	// it on mismatch. This costs at least one extra GetObject per Put and
+	// should be limited to keys like the ACME account key.
+	CriticalKey func(key string) bool
+	// SSEType is the server-side encryption objects are written with, one of
+	// s3.ServerSideEncryptionAes256 (SSE-S3), s3.ServerSideEncryptionAwsKms
+	// (SSE-KMS) or SSENone. If empty, it defaults to SSE-S3 (AES256), which
+	// is dropped if the store does not support it, see Put. SSENone never
+	// sends the header, e.g. for buckets enforcing their own default
+	// encryption. Put validates SSEType, KMSKeyID and EncryptionContext on
+	// every write, even if no header is sent; WithSSE validates them in New.
+	SSEType string
+	// KMSKeyID is the ID or ARN of the KMS key used for SSE-KMS. If empty,
+	// the AWS managed key is used. It must only be set with SSE-KMS.
+	KMSKeyID string
+	// EncryptionContext is the KMS encryption context objects are written
+	// with, e.g. to scope key grants or for auditing in CloudTrail. S3 stores
+	// it with the object and supplies it to KMS on reads, so Get needs no
+	// configuration. It is sent as base64 encoded JSON object, as S3
+	// expects it. It must only be set with SSE-KMS.
+	EncryptionContext map[string]string
+	// EncryptionContextFor returns additional encryption context for the
+	// object of a key, e.g. {"tenant": "acme"} taken from the context of
+	// the operation, so that KMS key policies can condition on it. Its
+	// entries take precedence over those of EncryptionContext. It must only
+	// return entries with SSE-KMS.
+	EncryptionContextFor func(ctx context.Context, key string) map[string]string
+	// Tags are attached to every object written, e.g. for cost allocation or
+	// lifecycle rules. S3 allows at most 10 tags per object, with keys of up
+	// to 128 and values of up to 256 characters. Put fails without writing
+	// anything if the tags violate these limits.
+	Tags map[string]string
+	// StorageClass is the storage class objects are written with, e.g.
+	// STANDARD_IA or INTELLIGENT_TIERING. If empty, S3 uses STANDARD.
+	StorageClass string
+	// StorageClassFor returns the storage class an object is written with,
+	// e.g. STANDARD for certificates read on every handshake and STANDARD_IA
+	// for the rarely read account key. An empty class uses StorageClass.
+	// Infrequent access classes charge per retrieval. GLACIER_IR still
+	// serves reads in milliseconds, but GLACIER and DEEP_ARCHIVE objects
+	// must be restored before Get can read them and must not be used.
+	StorageClassFor func(key string) string
+	// ACL is the canned ACL objects are written with, e.g.
+	// s3.ObjectCannedACLPrivate. If empty, no ACL is sent and the bucket's
+	// default applies. Buckets with ACLs disabled reject any ACL other than
+	// bucket-owner-full-control.
+	ACL string
+	// ObjectLockMode is the S3 Object Lock mode objects are written with,
+	// s3.ObjectLockModeGovernance or s3.ObjectLockModeCompliance. Each
+	// written version cannot be deleted or overwritten until
+	// ObjectLockRetention after the Put. The bucket must have Object Lock
+	// enabled. A Put and Delete of the key keep working, as they create a new
+	// version or a delete marker instead.
+	ObjectLockMode string
+	// ObjectLockRetention is how long versions written with ObjectLockMode
+	// are retained. Both or neither must be set.
+	ObjectLockRetention time.Duration
+	// UploadChecksum is the algorithm of a checksum sent with every
+	// PutObject, one of s3.ChecksumAlgorithmCrc32, s3.ChecksumAlgorithmCrc32c,
+	// s3.ChecksumAlgorithmSha1 or s3.ChecksumAlgorithmSha256. Set it for
+	// buckets whose policy rejects uploads without a checksum. This requires
+	// aws-sdk-go v1.43.0 or later.
+	UploadChecksum string
+	// PutGracePeriod lets a Put of a certificate or the account key continue
+	// for this long after its context is done, e.g. when autocert's final
+	// Put is canceled by a shutdown. Put then deviates from the usual
+	// contract and may return well after its context was canceled.
+	PutGracePeriod time.Duration
+	// GraceKey reports whether a key gets PutGracePeriod. If nil, these are
+	// the keys of certificates and the account key.
+	GraceKey func(key string) bool
+	// ContentAddressed additionally stores every version of an object under
+	// the SHA-256 of its data, so that nothing is ever overwritten. See
+	// Versions for details.
+	ContentAddressed bool
+	// HashKeys stores every object under the hex encoded SHA-256 of its key,
+	// so object keys have a fixed length and character set regardless of the
+	// domain. The original key is kept in the object's metadata, from which
+	// List recovers it, but the bucket is no longer readable by key in the
+	// S3 console. Changing this makes previously stored objects unreachable.
+	HashKeys bool
+	// KeySecret, if set, stores every object under the hex encoded
+	// HMAC-SHA256 of its key with this secret instead, regardless of
+	// HashKeys. Unlike HashKeys, the original key is not kept, so the
+	// domains can't be recovered from the bucket, its access logs or
+	// inventories without the secret and a list of candidate domains.
+	// Changing the secret makes previously stored objects unreachable.
+	KeySecret []byte
+	// KeyFunc, if set, transforms every key before it is appended to the
+	// prefix, e.g. to sanitize or shorten it, taking precedence over
+	// KeySecret and HashKeys. It must be deterministic and should not return
+	// keys containing slashes, which List skips. Changing it makes previously
+	// stored objects unreachable.
+	KeyFunc func(key string) string
+	// KeyTemplate composes object keys from placeholders instead of
+	// appending the key to the prefix, e.g. "{prefix}/{env}/{type}/{key}".
+	// The placeholders are {prefix} (without trailing slashes), {env} (the
+	// Environment), {tenant} (see MultiTenant, which requires it), {type}
+	// (see KeyType) and {key} (the key, transformed by KeyFunc, KeySecret or
+	// HashKeys). The template must end with {key}, and {prefix}, {env} and
+	// {tenant} must precede {type}. A placeholder that is empty drops the
+	// slash following it. An invalid template makes every operation fail;
+	// use WithKeyTemplate to have New validate it.
+	KeyTemplate string
+	// AllowKey reports whether a key may be written. A Put of a key it
+	// rejects fails with ErrKeyNotAllowed without writing anything. This lets
+	// a manager sharing the bucket with others refuse keys of domains outside
+	// its HostPolicy. autocert stores certificates under the plain domain
+	// name, with a "+rsa" suffix for RSA certificates; its other keys, like
+	// the account key "acme_account+key" or challenge tokens, contain a "+"
+	// and have to be allowed explicitly.
+	AllowKey func(key string) bool
+	// OnPrefixEmptied is called after a Delete that left no objects below
+	// the cache's prefix, i.e. Prefix followed by Environment. prefix is
+	// that object key prefix. Versions kept by ContentAddressed count as
+	// objects. Setting it costs an extra ListObjectsV2 per Delete.
+	OnPrefixEmptied func(ctx context.Context, prefix string)
+	// MemTTL enables an in-memory layer in front of S3. Data read by Get or
+	// written by Put is kept in memory for this long, so repeated Gets of a
+	// key don't each cost a request. HTTP-01 challenge tokens are never
+	// kept, nor their misses with MissTTL, see isTokenKey. Put and Delete
+	// update the layer of the Cache they are called on, but changes made by
+	// other instances sharing the bucket are only seen once the entry
+	// expires.
+	MemTTL time.Duration
+	// MemMaxStale lets Get serve data for this long after it expired from
+	// MemTTL, while a single read in the background refreshes it from S3, so
+	// a Get never waits for S3 for a key it has data of. The refresh keeps
+	// the values of the Get's context, but not its cancellation, and is
+	// bounded by DefaultTimeout. A refresh that misses drops the data.
+	// The refresh is a conditional read: it sends If-None-Match with the
+	// ETag of the data, or If-Modified-Since for stores that return no
+	// ETags, and a 304 Not Modified keeps the data for another MemTTL.
+	// Zero, the default, disables it.
+	MemMaxStale time.Duration
+	// MissTTL is how long Get remembers that a key does not exist, so that
+	// repeated Gets during a failing ACME authorization don't each cost a
+	// request. Keep it short, as autocert writes a certificate right after
+	// its Get missed and a Put from another instance does not clear it; a
+	// Put on this instance does. If zero, DefaultMissTTL is used, a
+	// conservative choice. A negative value disables it, e.g. if a miss
+	// hiding another instance's certificate for a few seconds may cause an
+	// unnecessary issuance.
+	//
+	// During an issuance storm, when many new domains are requested at once,
+	// concurrent Gets of a key already share one read (see Get), and
+	// DefaultMissTTL additionally absorbs the Gets autocert makes while it
+	// issues. Misses are returned at once, so issuance is never delayed, and
+	// the Put of the issued certificate clears the miss immediately.
+	MissTTL time.Duration
+	// Metrics, if set, is notified of every Get, Put and Delete.
+	Metrics Metrics
+	// MetricsLabel returns the label an operation is broken down by, e.g.
+	// TenantLabel to count every tenant separately. It is passed to Metrics
+	// implementing LabeledMetrics, set as Event.Label and logged as "label"
+	// by the StructuredLogger. If nil, operations are not labeled.
+	MetricsLabel func(ctx context.Context, key string) string
+	// Logger is used for debug logging. Failed operations are logged as
+	// well, at error level if Logger is a LevelLogger.
 	Logger Logger
+	// StructuredLogger, if set, is used instead of Logger. It receives a
+	// record of every Get, Put and Delete, see StructuredLogger.
+	StructuredLogger StructuredLogger
+	// ValidateDomainMatch makes Get parse certificates and verify that they are
+	// valid for the domain their key refers to, returning ErrDomainMismatch
+	// otherwise. Keys not holding certificates are not checked.
+	ValidateDomainMatch bool
+	// ValidateAccountData makes Get parse the ACME account key and report a
+	// cache miss if it is corrupted, instead of returning data autocert fails
+	// on. autocert then registers a new ACME account, which loses access to
+	// the old account's authorizations and revocation rights, so a corrupted
+	// key should rather be restored from a backup if one exists.
+	ValidateAccountData bool
+	// RefreshExpiredCredentials makes an operation that fails because the
+	// credentials have expired (ExpiredToken, ExpiredTokenException) expire
+	// the client's credentials and retry once with freshly retrieved ones.
+	// This only applies to clients created by New or NewWithProvider.
+	RefreshExpiredCredentials bool
+	// DefaultTimeout bounds every Get, Put and Delete including retries, so
+	// a stalled connection to S3 cannot hold up a TLS handshake forever.
+	// A deadline of the context passed to an operation still applies if it
+	// is sooner. Zero means no timeout.
+	DefaultTimeout time.Duration
+	// MaxRetries is the number of times Get, Put and Delete retry a request
+	// that failed with a transient error, like a 503 SlowDown, a 500 or a
+	// 409 OperationAborted from concurrent writes to the bucket. Misses and
+	// permanent errors are never retried. Clients created by New already
+	// retry in the SDK, so these retries come on top of those.
+	MaxRetries int
+	// RetryBaseDelay is the maximum delay before the first retry. It doubles
+	// with every retry and the actual delay is chosen randomly up to it.
+	// Defaults to 100ms.
+	RetryBaseDelay time.Duration
+	// RetryableCodes are the S3 error codes retried in addition to 5xx
+	// responses, throttling and broken connections. If nil,
+	// DefaultRetryableCodes are retried; an empty slice retries none.
+	RetryableCodes []string
+	// ContentionRetryDelay is used instead of RetryBaseDelay for requests S3
+	// aborted for a concurrent operation (409 OperationAborted), which
+	// clears quickly. Defaults to 10ms.
+	ContentionRetryDelay time.Duration
+	// ConsistentRead is how long after a Put by this Cache a Get of the same
+	// key that misses is retried, up to 5 times 100ms apart, for stores that
+	// are only eventually consistent, like older MinIO or Ceph releases. Puts
+	// by other instances are not known and not covered. Zero disables it;
+	// S3 itself is strongly consistent and doesn't need it.
+	ConsistentRead time.Duration
+	// HedgeDelay enables hedged reads. If a GetObject has not returned after
+	// this delay, a second one is issued and whichever returns first is used.
+	// This trades extra requests for lower tail latency.
+	HedgeDelay time.Duration
+	// MaxHedges limits the number of hedged requests in flight at once.
+	// Zero means no limit.
+	MaxHedges int
+	// EventBuffer is the buffer size of the channel returned by Events.
+	EventBuffer int
+	// ExpectedBucketOwner is the account ID that must own the bucket. If set,
+	// every request asserts it and fails with ErrAccessDenied if the bucket is
+	// owned by a different account.
+	ExpectedBucketOwner string
+	// SkipUnchangedPut stores a SHA-256 of the data with every object and
+	// skips writes whose data matches the stored hash. This costs an extra
+	// HeadObject per Put. Concurrent writers may still race between the
+	// comparison and the write.
+	SkipUnchangedPut bool
+	// Compress gzip-compresses objects before writing them. Get decompresses
+	// every object starting with the gzip magic bytes, whether this is set or
+	// not, so objects written with and without compression stay readable.
+	Compress bool
+	// CompressDictionaries are preset dictionaries for Compress, e.g.
+	// trained on typical certificate bundles, which share PEM headers and
+	// issuer chains. Objects are compressed with DEFLATE and the first
+	// dictionary instead of gzip and tagged with the ID of the dictionary, a
+	// hash of its contents. Get decompresses objects with the dictionary
+	// matching their ID and fails with ErrUnknownDictionary if none does.
+	// To switch to a new dictionary, prepend it and keep the previous ones
+	// until all objects have been rewritten.
+	CompressDictionaries [][]byte
+	// AEAD, if set, encrypts the data of every object before it is written,
+	// e.g. cipher.NewGCM of an AES-256 block cipher. The random nonce is
+	// stored in front of the ciphertext, and the object key is authenticated
+	// as associated data. Get then fails with ErrDecrypt for objects written
+	// without it, with another key or under another object key, e.g. after
+	// changing Prefix; use Migrate to move them. This is independent of
+	// SSEType, so both can be used together.
+	AEAD cipher.AEAD
+	// ContentType is the Content-Type objects are written with. If empty,
+	// certificates and the account key are written as application/x-pem-file
+	// and everything else as application/octet-stream. Get ignores it.
+	ContentType string
+	// VerifyChecksum stores a SHA-256 of the data with every object and makes
+	// Get verify the data it reads against it, returning ErrChecksumMismatch
+	// if they differ. The checksum is read along with the data, so this costs
+	// no extra request. Objects written without a checksum are not verified.
+	VerifyChecksum bool
+	// TrackGeneration stores a generation number with every object that is
+	// incremented on each Put. The write is conditional on the object not
+	// having changed since its generation was read, which requires a bucket
+	// supporting conditional writes. A Put losing the race returns ErrConflict.
+	//
+	// This gives optimistic concurrency between instances renewing the same
+	// certificate: a slow Put fails instead of overwriting a newer one. Each
+	// Put costs an extra HeadObject to read the ETag the write is made
+	// conditional on (If-Match, or If-None-Match for a new object).
+	TrackGeneration bool
+	// ReadOnly makes every operation that would modify the bucket, like Put
+	// and Delete, return ErrReadOnly without sending a request, while Get
+	// keeps working. Use it to point e.g. a staging deployment at the
+	// production bucket without risking changes to it.
+	ReadOnly bool
+	// Replica makes Get read from a replica of the bucket, see Replica.
+	Replica *Replica
+	// EvictionMinAge protects objects modified less than this long ago from
+	// being deleted by EnforceSizeLimit.
+	EvictionMinAge time.Duration
+	// EvictionStorageClass makes EnforceSizeLimit move evicted objects to
+	// this storage class instead of deleting them, e.g. STANDARD_IA. Objects
+	// already in it do not count against the limit. It has to be a class
+	// that can be read without a restore, so neither GLACIER nor
+	// DEEP_ARCHIVE.
+	EvictionStorageClass string
+	// ListConcurrency makes List and the other operations that walk the
+	// cache's prefix, like EnforceSizeLimit and Migrate, split the key space
+	// into ranges at the first character after the prefix and list up to
+	// this many ranges concurrently. This speeds up prefixes with hundreds
+	// of thousands of objects. The objects are passed on in the same order
+	// as by serial listing, which is used if it is at most 1.
+	ListConcurrency int
+	// ListFailure controls what happens when a page of such a listing
+	// fails, see ListFailure.
+	ListFailure ListFailure
 
 	bucket string
 	s3     s3iface.S3API
+	cdn    *CDN
+
+	newClient func() (s3iface.S3API, error)
+	initOnce  sync.Once
+	initErr   error
+
+	prefix atomic.Value
+	hedges int32
+	noSSE  int32
+	listV1 int32
+
+	memMu    sync.Mutex
+	mem      map[string]memEntry
+	memStats MemStats
+	memGen   uint64
+
+	flightMu sync.Mutex
+	flights  map[string]*flight
+
+	writtenMu sync.Mutex
+	written   map[string]time.Time
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closed    int32
+
+	templateOnce sync.Once
+	template     *keyTemplate
+	templateErr  error
+
+	eventsMu      sync.Mutex
+	events        chan Event
+	droppedEvents uint64
 }
 
+// newSession is replaced in tests.
+var newSession = session.NewSession
+
 // New creates an s3 instance that can be used with autocert.Cache.
-// It returns any errors that could happen while connecting to S3.
-func New(region, bucket string) (*Cache, error) {
-	sess, err := session.NewSession(&aws.Config{
+// It returns any errors that could happen while connecting to S3,
+// or if the bucket name is invalid.
+func New(region, bucket string, opts ...Option) (*Cache, error) {
+	return NewWithConfig(&aws.Config{
 		CredentialsChainVerboseErrors: aws.Bool(true),
-		Region: aws.String(region),
-	})
-	if err != nil {
+		Region:                        aws.String(region),
+	}, bucket, opts...)
+}
+
+// NewWithConfig is like New, but creates the AWS session from cfg, which
+// allows setting e.g. the credentials, retryer, HTTP client or endpoint
+// resolver. Options are applied to a copy of cfg and take precedence over it.
+func NewWithConfig(cfg *aws.Config, bucket string, opts ...Option) (*Cache, error) {
+	o := newOptions(opts)
+	if err := validateBucket(bucket, o.bucketValidation); err != nil {
 		return nil, err
 	}
+	if o.keyTemplate != "" {
+		if _, err := parseKeyTemplate(o.keyTemplate); err != nil {
+			return nil, err
+		}
+	}
+	if o.sse != nil {
+		if err := validateSSE(o.sse.Type, o.sse.KMSKeyID, o.sse.EncryptionContext); err != nil {
+			return nil, err
+		}
+	}
+
+	config := cfg.Copy()
+	o.apply(config)
+
+	newClient := func() (s3iface.S3API, error) {
+		sess, err := newSession(config)
+		if err != nil {
+			return nil, err
+		}
+		if o.assumeRole != nil {
+			creds := assumeRoleCredentials(sess, o.assumeRole.RoleARN, o.assumeRole.provider)
+			return withRedirectErrors(s3.New(sess, &aws.Config{Credentials: creds})), nil
+		}
+		return withRedirectErrors(s3.New(sess)), nil
+	}
+	cache := &Cache{bucket: bucket, newClient: newClient, cdn: o.cdn, KeyTemplate: o.keyTemplate}
+	if o.sse != nil {
+		cache.SSEType, cache.KMSKeyID, cache.EncryptionContext = o.sse.Type, o.sse.KMSKeyID, o.sse.EncryptionContext
+	}
+	if !o.lazyInit {
+		svc, err := newClient()
+		if err != nil {
+			return nil, err
+		}
+		cache.s3, cache.newClient = svc, nil
+	}
 
-	return NewWithProvider(sess, bucket)
+	if o.keepAlive > 0 {
+		cache.startKeepAlive(o.keepAlive)
+	}
+	return cache, nil
 }
 
 // NewWithProvider creates a new s3 autocert.Cache from a client.ConfigProvider.
 func NewWithProvider(p client.ConfigProvider, bucket string) (*Cache, error) {
-	return NewWithS3(s3.New(p), bucket)
+	return NewWithS3(withRedirectErrors(s3.New(p)), bucket)
 }
 
 // NewWithS3 creates a new s3 autocert.Cache from a s3iface.S3API.
@@ -66,119 +525,685 @@ func NewWithS3(s3 s3iface.S3API, bucket string) (*Cache, error) {
 	}, nil
 }
 
+// client returns the s3 client, creating it first if initialization was deferred.
+func (c *Cache) client() (s3iface.S3API, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+	if c.newClient != nil {
+		c.initOnce.Do(func() {
+			c.s3, c.initErr = c.newClient()
+		})
+	}
+	return c.s3, c.initErr
+}
+
 func (c *Cache) log(format string, v ...interface{}) {
+	if c.StructuredLogger != nil {
+		c.StructuredLogger.Log(LevelDebug, fmt.Sprintf(format, v...), nil)
+		return
+	}
 	if c.Logger == nil {
 		return
 	}
+	if l, ok := c.Logger.(LevelLogger); ok {
+		l.Debugf(format, v...)
+		return
+	}
 	c.Logger.Printf(format, v...)
 }
 
-func (c *Cache) get(key string) ([]byte, error) {
-	resp, err := c.s3.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(c.bucket),
-		Key:    aws.String(key),
-	})
+func (c *Cache) logError(format string, v ...interface{}) {
+	if c.StructuredLogger != nil {
+		c.StructuredLogger.Log(LevelError, fmt.Sprintf(format, v...), nil)
+		return
+	}
+	if c.Logger == nil {
+		return
+	}
+	if l, ok := c.Logger.(LevelLogger); ok {
+		l.Errorf(format, v...)
+		return
+	}
+	c.Logger.Printf(format, v...)
+}
+
+// logOperation logs a finished Get, Put or Delete. A StructuredLogger gets a
+// record of every operation; otherwise only failures are logged, as the
+// operation was already traced when it started. Misses are not failures.
+func (c *Cache) logOperation(op, key, label string, start time.Time, err error) {
+	if c.StructuredLogger != nil {
+		c.logRecord(op, key, label, start, err)
+		return
+	}
+	if err != nil && err != autocert.ErrCacheMiss {
+		c.logError("S3 Cache %s %s failed: %v", op, key, err)
+	}
+}
+
+// objectKey returns the s3 object key for the specified cache key.
+func (c *Cache) objectKey(ctx context.Context, key string) (string, error) {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return "", err
+	}
+	return prefix + c.objectName(key), nil
+}
+
+// objectName returns the part of the s3 object key following the prefix of
+// the operation, rendered by KeyTemplate if set.
+func (c *Cache) objectName(key string) string {
+	name := c.transformKey(key)
+	if t, _ := c.keyTemplate(); t != nil {
+		return render(t.name, map[string]string{"type": KeyType(key), "key": name})
+	}
+	return name
+}
+
+// transformKey returns the cache key as it appears in the s3 object key,
+// transformed by KeyFunc or hashed if HashKeys or KeySecret is set.
+func (c *Cache) transformKey(key string) string {
+	if c.KeyFunc != nil {
+		return c.KeyFunc(key)
+	}
+	if c.KeySecret != nil {
+		return hmacKey(c.KeySecret, key)
+	}
+	if c.HashKeys {
+		return hashKey(key)
+	}
+	return key
+}
+
+// keyPrefix returns the part of the s3 object key preceding every cache key
+// of the operation with ctx.
+func (c *Cache) keyPrefix(ctx context.Context) (string, error) {
+	if t, err := c.keyTemplate(); t != nil || err != nil {
+		if err != nil {
+			return "", err
+		}
+		return c.templatePrefix(ctx, t)
+	}
+
+	prefix, err := c.environmentPrefix()
+	if err != nil || !c.MultiTenant {
+		return prefix, err
+	}
+
+	tenant, _ := TenantFromContext(ctx)
+	if tenant == "" || strings.Contains(tenant, "/") {
+		return "", ErrInvalidTenant
+	}
+	return prefix + tenant + "/", nil
+}
+
+// environmentPrefix returns the prefix followed by the environment, if any.
+func (c *Cache) environmentPrefix() (string, error) {
+	if strings.Contains(c.Environment, "/") {
+		return "", ErrInvalidEnvironment
+	}
+	if c.Environment != "" {
+		return c.normalizedPrefix() + c.Environment + "/", nil
+	}
+	if c.RequireEnvironment {
+		return "", ErrInvalidEnvironment
+	}
+	return c.normalizedPrefix(), nil
+}
+
+// normalizedPrefix returns the prefix ending with PrefixSeparator, unless it
+// is empty or RawPrefix is set.
+func (c *Cache) normalizedPrefix() string {
+	return objectkey.Prefix(c.GetPrefix(), c.PrefixSeparator, c.RawPrefix)
+}
+
+// SetPrefix sets the prefix of every objects key cached in s3.
+// It is safe to call while the cache is in use.
+func (c *Cache) SetPrefix(prefix string) {
+	c.prefix.Store(prefix)
+}
+
+// GetPrefix returns the prefix set by SetPrefix, or Prefix if it was never called.
+func (c *Cache) GetPrefix() string {
+	if prefix, ok := c.prefix.Load().(string); ok {
+		return prefix
+	}
+	return c.Prefix
+}
+
+func (c *Cache) get(ctx context.Context, key string) ([]byte, error) {
+	svc, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	return c.getFrom(ctx, svc, c.bucket, key)
+}
+
+// getFrom gets the object from bucket, which is the Cache's bucket or its
+// replica.
+func (c *Cache) getFrom(ctx context.Context, svc s3iface.S3API, bucket, key string) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	}
+	v := validatorsFromContext(ctx)
+	if v != nil {
+		v.setConditions(input)
+	}
+	resp, err := svc.GetObjectWithContext(ctx, input)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength != nil && int64(len(data)) < *resp.ContentLength {
+		return nil, ErrTruncated
+	}
+	if data, err = c.decode(key, data, aws.StringValue(resp.Metadata[checksumMetadataKey])); err != nil {
+		return nil, err
+	}
+	if v != nil {
+		v.record(resp)
+	}
+	return data, nil
+}
+
+// decode reverses the encryption and compression of the data of the object
+// key, and verifies it against the checksum sum stored with the object.
+func (c *Cache) decode(key string, data []byte, sum string) ([]byte, error) {
+	var err error
+	if c.AEAD != nil {
+		if data, err = c.decrypt(key, data); err != nil {
+			return nil, err
+		}
+	}
+	if data, err = decompress(data, c.CompressDictionaries); err != nil {
+		return nil, err
+	}
+	if c.VerifyChecksum {
+		if err := verifyChecksum(data, sum); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
 }
 
 // Get returns a certificate data for the specified key.
+//
+// Concurrent Gets for the same key share a single read and all receive its
+// result, e.g. when many handshakes for a domain arrive at a cold start.
 func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
-	key = c.Prefix + key
+	start := time.Now()
+	data, err := c.doGet(ctx, key)
+	label := c.metricsLabel(ctx, key)
+	c.logOperation("Get", key, label, start, err)
+	c.observeGet(label, start, err)
+	c.emit("Get", key, label, start, err)
+	return data, err
+}
+
+func (c *Cache) doGet(ctx context.Context, key string) ([]byte, error) {
+	if c.isClosed() {
+		return nil, ErrClosed
+	}
+
+	ctx, cancel := c.withDefaultTimeout(ctx)
+	defer cancel()
+
+	name := key
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data, miss, stale, ok := c.memLoad(key); ok && !isTokenKey(name) {
+		c.log("S3 Cache Get %s from memory", key)
+		if miss {
+			return nil, autocert.ErrCacheMiss
+		}
+		if stale {
+			c.revalidate(ctx, name, key)
+		}
+		return data, nil
+	}
 	c.log("S3 Cache Get %s", key)
 
+	return c.sharedRead(ctx, name, key)
+}
+
+// read reads the object of the cache key name from the CDN or S3 and
+// validates it.
+func (c *Cache) read(ctx context.Context, name, key string) ([]byte, error) {
+	domain, isCert := certDomain(name)
+	isAccount := isAccountKey(name)
+
 	var (
 		data []byte
 		err  error
-		done = make(chan struct{})
+		done bool
 	)
-
-	go func() {
-		data, err = c.get(key)
-		close(done)
-	}()
-
-	select {
-	case <-ctx.Done():
+	if c.cdn != nil {
+		if data, err = c.cdn.get(ctx, key, c.decode); err != nil {
+			c.logError("S3 Cache Get %s from CDN failed, falling back to S3: %v", key, err)
+		}
+		done = err == nil
+	}
+	if !done && c.Replica != nil {
+		data, err = c.readReplica(ctx, key)
+		done = err == nil || isNotModified(err) || isNotFound(err) && !c.Replica.ReadPrimaryOnMiss
+		if !done {
+			c.logError("S3 Cache Get %s from replica failed, falling back to primary: %v", key, err)
+		}
+	}
+	if !done {
+		err = c.retrying(ctx, func() error {
+			return c.refreshingCredentials(func() (err error) {
+				data, err = c.hedgedGet(ctx, key)
+				return err
+			})
+		})
+	}
+	if err != nil && ctx.Err() != nil {
 		return nil, ctx.Err()
-	case <-done:
 	}
 
-	if awsErr, ok := err.(awserr.RequestFailure); ok {
-		if awsErr.StatusCode() == http.StatusNotFound {
+	if isNoSuchBucket(err) {
+		return nil, ErrNoSuchBucket
+	}
+	if isNotFound(err) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if isAccessDenied(err) {
+		return nil, c.accessDenied("Get", key, err)
+	}
+	if err == nil && c.ValidateDomainMatch && isCert {
+		if err = verifyDomain(domain, data); err != nil {
+			c.log("S3 Cache Get %s does not match domain %s: %v", key, domain, err)
+			return nil, err
+		}
+	}
+	if err == nil && c.ValidateAccountData && isAccount {
+		if err = verifyAccountKey(data); err != nil {
+			c.log("S3 Cache Get %s is not a valid account key: %v", key, err)
 			return nil, autocert.ErrCacheMiss
 		}
 	}
 
-	return data, err
+	return data, c.wrapError(ctx, "get", key, err)
 }
 
-func (c *Cache) put(key string, data []byte) error {
-	_, err := c.s3.PutObject(&s3.PutObjectInput{
-		Bucket:               aws.String(c.bucket),
-		Key:                  aws.String(key),
-		Body:                 bytes.NewReader(data),
-		ServerSideEncryption: aws.String("AES256"),
-	})
+// contentType returns the Content-Type of the object of the cache key name.
+func (c *Cache) contentType(name string) string {
+	if c.ContentType != "" {
+		return c.ContentType
+	}
+	if _, isCert := certDomain(name); isCert || isAccountKey(name) {
+		return "application/x-pem-file"
+	}
+	return "application/octet-stream"
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+const (
+	checksumMetadataKey = "Checksum"
+	keyMetadataKey      = "Key"
+)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChecksum checks data against the checksum stored with its object.
+// Objects written without a checksum pass.
+func verifyChecksum(data []byte, sum string) error {
+	if sum != "" && sum != checksum(data) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+func hashKey(key string) string {
+	return checksum([]byte(key))
+}
+
+func hmacKey(secret []byte, key string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isNotFound(err error) bool {
+	if isNoSuchBucket(err) {
+		return false
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return true
+	}
+	return hasErrorCode(err, s3.ErrCodeNoSuchKey, "NotFound")
+}
+
+func isAccessDenied(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusForbidden {
+		return true
+	}
+	return hasErrorCode(err, "AccessDenied")
+}
+
+// isNoSuchBucket reports whether err is caused by the bucket not existing.
+// S3 responds to that with a 404 as well, which must not be mistaken for a
+// missing object.
+func isNoSuchBucket(err error) bool {
+	return hasErrorCode(err, s3.ErrCodeNoSuchBucket)
+}
+
+// hasErrorCode reports whether err is an AWS error with one of codes. Not all
+// errors carry a status code, for example those returned by S3 compatible
+// services or from within a batch.
+func hasErrorCode(err error, codes ...string) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	for _, code := range codes {
+		if awsErr.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapError adds the operation and object key to errors returned by S3,
+// which do not mention either, or turns them into a RegionError if the
+// bucket is in another region. The original error can be retrieved using
+// errors.As.
+func (c *Cache) wrapError(ctx context.Context, op, key string, err error) error {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return err
+	}
+	if awsErr.Code() == bucketRegionErrorCode {
+		if err := c.regionError(ctx, err); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("s3cache: %s %s: %w", op, key, err)
+}
+
+func (c *Cache) put(ctx context.Context, name, key string, data []byte) error {
+	sse := c.SSEType != "" || c.sseSupported()
+	err := c.putObject(ctx, name, key, data, sse)
+	if sse && c.SSEType == "" && isSSEUnsupported(err) {
+		c.log("S3 Cache Put %s server-side encryption not supported, retrying without", key)
+		c.disableSSE()
+		return c.putObject(ctx, name, key, data, false)
+	}
 	return err
 }
 
+func (c *Cache) putObject(ctx context.Context, name, key string, data []byte, sse bool) error {
+	svc, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	body := data
+	if c.Compress {
+		if body, err = compress(data, c.compressDictionary()); err != nil {
+			return err
+		}
+	}
+	if c.AEAD != nil {
+		if body, err = c.encrypt(key, body); err != nil {
+			return err
+		}
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		Body:                bytes.NewReader(body),
+		ContentType:         aws.String(c.contentType(name)),
+		Metadata:            map[string]*string{},
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	}
+	if c.Compress && c.AEAD == nil && c.compressDictionary() == nil {
+		// Encrypted objects or those compressed with a dictionary are not
+		// gzip to anyone but the Cache, and clients decompressing
+		// transparently would choke on them.
+		input.ContentEncoding = aws.String(gzipEncoding)
+	}
+	if err := c.setSSE(ctx, input, name, sse); err != nil {
+		return err
+	}
+	if err := c.setStorageClass(input, name); err != nil {
+		return err
+	}
+	if err := c.setACL(input); err != nil {
+		return err
+	}
+	if err := c.setObjectLock(input); err != nil {
+		return err
+	}
+	if err := c.setUploadChecksum(input, body); err != nil {
+		return err
+	}
+	if err := c.setTagging(input); err != nil {
+		return err
+	}
+	if c.SkipUnchangedPut || c.VerifyChecksum {
+		sum := checksum(data)
+		if c.SkipUnchangedPut {
+			if head, err := c.head(ctx, key); err == nil && aws.StringValue(head.Metadata[checksumMetadataKey]) == sum {
+				c.log("S3 Cache Put %s unchanged", key)
+				return nil
+			}
+		}
+		input.Metadata[checksumMetadataKey] = aws.String(sum)
+	}
+	if c.storesKeys() {
+		input.Metadata[keyMetadataKey] = aws.String(name)
+	}
+	input.Metadata[updatedAtMetadataKey] = aws.String(time.Now().UTC().Format(time.RFC3339))
+	if c.ContentAddressed {
+		if err := c.putContent(ctx, svc, input, data, body); err != nil {
+			return err
+		}
+	}
+	if c.TrackGeneration {
+		return c.putGeneration(ctx, svc, input)
+	}
+
+	_, err = svc.PutObjectWithContext(ctx, input)
+	return err
+}
+
+// criticalPutAttempts is the number of times a critical key is written before
+// giving up on verifying it.
+const criticalPutAttempts = 3
+
+func (c *Cache) putVerified(ctx context.Context, name, key string, data []byte) error {
+	for i := 0; i < criticalPutAttempts; i++ {
+		if err := c.put(ctx, name, key, data); err != nil {
+			return err
+		}
+
+		stored, err := c.get(ctx, key)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		if err == nil && bytes.Equal(stored, data) {
+			return nil
+		}
+		c.log("S3 Cache Put %s verification failed", key)
+	}
+	return ErrVerifyFailed
+}
+
 // Put stores the data in the cache under the specified key.
+//
+// Unless SSEType is set, objects are written with server-side encryption
+// (SSE-S3). Some S3-compatible stores don't implement it and reject such
+// writes. The first time a store does, Put retries without encryption and
+// omits it from then on. An explicitly set SSEType is never dropped.
 func (c *Cache) Put(ctx context.Context, key string, data []byte) error {
-	key = c.Prefix + key
-	c.log("S3 Cache Put %s", key)
+	start := time.Now()
+	err := c.doPut(ctx, key, data)
+	label := c.metricsLabel(ctx, key)
+	c.logOperation("Put", key, label, start, err)
+	c.observePut(label, start, err)
+	c.emit("Put", key, label, start, err)
+	return err
+}
 
-	var (
-		err  error
-		done = make(chan struct{})
-	)
+func (c *Cache) doPut(ctx context.Context, key string, data []byte) error {
+	if c.ReadOnly {
+		return ErrReadOnly
+	}
+	if c.AllowKey != nil && !c.AllowKey(key) {
+		c.log("S3 Cache Put %s not allowed", key)
+		return ErrKeyNotAllowed
+	}
 
-	go func() {
-		err = c.put(key, data)
-		close(done)
-	}()
+	ctx, cancel := c.withDefaultTimeout(ctx)
+	defer cancel()
 
-	select {
-	case <-ctx.Done():
+	if c.graceKey(key) {
+		var cancel context.CancelFunc
+		ctx, cancel = withGrace(ctx, c.PutGracePeriod)
+		defer cancel()
+	}
+
+	name := key
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	c.log("S3 Cache Put %s", key)
+
+	err = c.retrying(ctx, func() error {
+		return c.refreshingCredentials(func() error {
+			if c.CriticalKey != nil && c.CriticalKey(name) {
+				return c.putVerified(ctx, name, key, data)
+			}
+			return c.put(ctx, name, key, data)
+		})
+	})
+	if err != nil || isTokenKey(name) {
+		c.memInvalidate(key)
+	} else {
+		c.memUpdate(key, data)
+	}
+	if err == nil {
+		c.markWritten(key)
+	}
+	if err != nil && ctx.Err() != nil {
 		return ctx.Err()
-	case <-done:
 	}
 
-	return err
+	if isNoSuchBucket(err) {
+		return ErrNoSuchBucket
+	}
+	if isAccessDenied(err) {
+		return c.accessDenied("Put", key, err)
+	}
+	return c.wrapError(ctx, "put", key, err)
 }
 
-func (c *Cache) delete(key string) error {
-	_, err := c.s3.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(c.bucket),
-		Key:    aws.String(key),
+func (c *Cache) delete(ctx context.Context, key string) error {
+	svc, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
 	})
 	return err
 }
 
 // Delete removes a certificate data from the cache under the specified key.
 func (c *Cache) Delete(ctx context.Context, key string) error {
-	key = c.Prefix + key
-	c.log("S3 Cache Delete %s", key)
+	start := time.Now()
+	err := c.doDelete(ctx, key)
+	label := c.metricsLabel(ctx, key)
+	c.logOperation("Delete", key, label, start, err)
+	c.observeDelete(label, start, err)
+	c.emit("Delete", key, label, start, err)
+	return err
+}
 
-	var (
-		err  error
-		done = make(chan struct{})
-	)
+func (c *Cache) doDelete(ctx context.Context, key string) error {
+	if c.ReadOnly {
+		return ErrReadOnly
+	}
 
-	go func() {
-		err = c.delete(key)
-		close(done)
-	}()
+	ctx, cancel := c.withDefaultTimeout(ctx)
+	defer cancel()
+
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	c.log("S3 Cache Delete %s", key)
 
-	select {
-	case <-ctx.Done():
+	err = c.retrying(ctx, func() error {
+		return c.refreshingCredentials(func() error {
+			return c.delete(ctx, key)
+		})
+	})
+	c.memInvalidate(key)
+	c.forgetWritten(key)
+	if err != nil && ctx.Err() != nil {
 		return ctx.Err()
-	case <-done:
 	}
 
-	return err
+	if isNoSuchBucket(err) {
+		return ErrNoSuchBucket
+	}
+	if isAccessDenied(err) {
+		return c.accessDenied("Delete", key, err)
+	}
+	if err == nil && c.OnPrefixEmptied != nil {
+		c.notifyPrefixEmptied(ctx)
+	}
+	return c.wrapError(ctx, "delete", key, err)
+}
+
+// notifyPrefixEmptied calls OnPrefixEmptied if no objects are left below the
+// cache's prefix. Failing to find out is only logged, as the Delete itself
+// succeeded.
+func (c *Cache) notifyPrefixEmptied(ctx context.Context) {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return
+	}
+
+	var empty bool
+	err = c.refreshingCredentials(func() (err error) {
+		empty, err = c.isEmpty(ctx, prefix)
+		return err
+	})
+	if err != nil {
+		c.logError("S3 Cache Delete checking if %s is empty failed: %v", prefix, err)
+		return
+	}
+	if empty {
+		c.OnPrefixEmptied(ctx, prefix)
+	}
 }
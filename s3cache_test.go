@@ -5,11 +5,21 @@ package s3cache
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/stretchr/testify/assert"
@@ -37,37 +47,191 @@ func TestLogger(t *testing.T) {
 	assert.True(t, l.called)
 }
 
+type testLevelLogger struct {
+	debug, errors []string
+}
+
+func (l *testLevelLogger) Printf(format string, v ...interface{}) {
+	panic("Printf called on a LevelLogger")
+}
+
+func (l *testLevelLogger) Debugf(format string, v ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, v...))
+}
+
+func (l *testLevelLogger) Errorf(format string, v ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, v...))
+}
+
+func TestLevelLogger(t *testing.T) {
+	l := &testLevelLogger{}
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, Logger: l}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Equal(t, []string{"S3 Cache Get dummy"}, l.debug)
+	assert.Empty(t, l.errors)
+
+	cache.s3 = &failingPutS3{testS3: &testS3{cache: map[string][]byte{}}, fail: "dummy"}
+	assert.Equal(t, errTestPut, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, []string{"S3 Cache Put dummy failed: put failed"}, l.errors)
+}
+
 type testS3 struct {
 	s3iface.S3API
-	cache map[string][]byte
+	cache    map[string][]byte
+	meta     map[string]map[string]*string
+	modified map[string]time.Time
+	inputs   map[string]*s3.PutObjectInput
+	owner    string
 }
 
-func (t *testS3) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+func (t *testS3) checkOwner(owner *string) error {
+	if t.owner != "" && aws.StringValue(owner) != t.owner {
+		return awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+	}
+	return nil
+}
+
+func (t *testS3) etag(key string) string {
+	sum := md5.Sum(t.cache[key])
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (t *testS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if err := t.checkOwner(input.ExpectedBucketOwner); err != nil {
+		return nil, err
+	}
+	b, ok := t.cache[*input.Key]
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+	}
+
+	head := &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(b))),
+		ETag:          aws.String(t.etag(*input.Key)),
+		Metadata:      t.meta[*input.Key],
+	}
+	if modified, ok := t.modified[*input.Key]; ok {
+		head.LastModified = aws.Time(modified)
+	}
+	if put, ok := t.inputs[*input.Key]; ok {
+		head.StorageClass = put.StorageClass
+	}
+	return head, nil
+}
+
+func (t *testS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := t.checkOwner(input.ExpectedBucketOwner); err != nil {
+		return nil, err
+	}
 	b, ok := t.cache[*input.Key]
 	if !ok {
-		return nil, awserr.NewRequestFailure(nil, http.StatusNotFound, "")
+		return nil, awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), http.StatusNotFound, "")
 	}
 
 	return &s3.GetObjectOutput{
-		Body: ioutil.NopCloser(bytes.NewReader(b)),
+		Body:     ioutil.NopCloser(bytes.NewReader(b)),
+		Metadata: t.meta[*input.Key],
 	}, nil
 }
 
-func (t *testS3) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+func (t *testS3) putObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if err := t.checkOwner(input.ExpectedBucketOwner); err != nil {
+		return nil, err
+	}
 	b, err := ioutil.ReadAll(input.Body)
 	if err != nil {
 		return nil, err
 	}
 
 	t.cache[*input.Key] = b
+	if t.meta == nil {
+		t.meta = map[string]map[string]*string{}
+	}
+	t.meta[*input.Key] = input.Metadata
+	if t.modified == nil {
+		t.modified = map[string]time.Time{}
+	}
+	t.modified[*input.Key] = time.Now()
+	if t.inputs == nil {
+		t.inputs = map[string]*s3.PutObjectInput{}
+	}
+	t.inputs[*input.Key] = input
 	return &s3.PutObjectOutput{}, nil
 }
 
-func (t *testS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+func (t *testS3) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if err := t.checkOwner(input.ExpectedBucketOwner); err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range t.cache {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) && key > aws.StringValue(input.StartAfter) && key > aws.StringValue(input.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// A small default page size exercises pagination.
+	maxKeys := 2
+	if input.MaxKeys != nil {
+		maxKeys = int(*input.MaxKeys)
+	}
+
+	resp := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(len(keys) > maxKeys)}
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+		resp.NextContinuationToken = aws.String(keys[maxKeys-1])
+	}
+	for _, key := range keys {
+		resp.Contents = append(resp.Contents, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(t.cache[key]))),
+			LastModified: aws.Time(t.modified[key]),
+		})
+	}
+	return resp, nil
+}
+
+func (t *testS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	r.ApplyOptions(opts...)
+	r.Handlers.Build.Run(r)
+
+	_, exists := t.cache[*input.Key]
+	if m := r.HTTPRequest.Header.Get("If-Match"); m != "" && (!exists || m != t.etag(*input.Key)) {
+		return nil, awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), http.StatusPreconditionFailed, "")
+	}
+	if r.HTTPRequest.Header.Get("If-None-Match") == "*" && exists {
+		return nil, awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), http.StatusPreconditionFailed, "")
+	}
+
+	return t.putObject(input)
+}
+
+func (t *testS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if err := t.checkOwner(input.ExpectedBucketOwner); err != nil {
+		return nil, err
+	}
 	delete(t.cache, *input.Key)
+	delete(t.meta, *input.Key)
 	return &s3.DeleteObjectOutput{}, nil
 }
 
+func (t *testS3) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if err := t.checkOwner(input.ExpectedBucketOwner); err != nil {
+		return nil, err
+	}
+	for _, obj := range input.Delete.Objects {
+		delete(t.cache, *obj.Key)
+		delete(t.meta, *obj.Key)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
 func TestCache(t *testing.T) {
 	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}}
 	ctx := context.Background()
@@ -111,3 +275,512 @@ func TestCacheWithPrefix(t *testing.T) {
 	_, err = cache.Get(ctx, "dummy")
 	assert.Equal(t, autocert.ErrCacheMiss, err)
 }
+
+type countingS3 struct {
+	*testS3
+	gets    int
+	puts    int
+	corrupt int
+}
+
+func (c *countingS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	c.gets++
+	return c.testS3.GetObjectWithContext(ctx, input, opts...)
+}
+
+func (c *countingS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	c.puts++
+	if c.corrupt > 0 {
+		c.corrupt--
+		input.Body = bytes.NewReader([]byte("corrupt"))
+	}
+	return c.testS3.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheSkipUnchangedPut(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, SkipUnchangedPut: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, 1, testS3Cache.puts)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, 1, testS3Cache.puts)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{2}))
+	assert.Equal(t, 2, testS3Cache.puts)
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+}
+
+func TestCacheVerifyChecksum(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"legacy": {1}}}
+	cache := &Cache{s3: testS3Cache, VerifyChecksum: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, checksum([]byte{1}), aws.StringValue(testS3Cache.meta["dummy"][checksumMetadataKey]))
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	b, err = cache.Get(ctx, "legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	_, err = cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	testS3Cache.cache["dummy"] = []byte{2}
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, ErrChecksumMismatch, err)
+
+	cache.VerifyChecksum = false
+	b, err = cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+}
+
+func TestCacheExpectedBucketOwner(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}, owner: "111111111111"}
+	cache := &Cache{s3: testS3Cache, ExpectedBucketOwner: "111111111111", TrackGeneration: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	_, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	_, err = cache.Generation(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+
+	cache.ExpectedBucketOwner = "222222222222"
+	assert.Equal(t, ErrAccessDenied, cache.Put(ctx, "dummy", []byte{1}))
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, ErrAccessDenied, err)
+	_, err = cache.Generation(ctx, "dummy")
+	assert.Equal(t, ErrAccessDenied, err)
+	assert.Equal(t, ErrAccessDenied, cache.Delete(ctx, "dummy"))
+}
+
+func TestCachePrefixNormalization(t *testing.T) {
+	for _, test := range []struct {
+		cache    *Cache
+		expected string
+	}{
+		{&Cache{}, "dummy"},
+		{&Cache{Prefix: "certs"}, "certs/dummy"},
+		{&Cache{Prefix: "certs/"}, "certs/dummy"},
+		{&Cache{Prefix: "certs", PrefixSeparator: ":"}, "certs:dummy"},
+		{&Cache{Prefix: "certs:", PrefixSeparator: ":"}, "certs:dummy"},
+		{&Cache{Prefix: "certs-", RawPrefix: true}, "certs-dummy"},
+		{&Cache{Prefix: "certs", Environment: "prod"}, "certs/prod/dummy"},
+	} {
+		testS3Cache := &testS3{cache: map[string][]byte{}}
+		test.cache.s3 = testS3Cache
+		assert.NoError(t, test.cache.Put(context.Background(), "dummy", []byte{1}))
+		assert.Equal(t, map[string][]byte{test.expected: {1}}, testS3Cache.cache)
+	}
+}
+
+func TestCacheWithEnvironment(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	ctx := context.Background()
+
+	dev := &Cache{s3: testS3Cache, Prefix: "certs/", Environment: "dev", RequireEnvironment: true}
+	prod := &Cache{s3: testS3Cache, Prefix: "certs/", Environment: "prod", RequireEnvironment: true}
+
+	assert.NoError(t, dev.Put(ctx, "dummy", []byte{1}))
+	assert.NoError(t, prod.Put(ctx, "dummy", []byte{2}))
+	assert.Equal(t, []byte{1}, testS3Cache.cache["certs/dev/dummy"])
+	assert.Equal(t, []byte{2}, testS3Cache.cache["certs/prod/dummy"])
+
+	b, err := dev.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	assert.NoError(t, dev.Delete(ctx, "dummy"))
+	_, err = dev.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	assert.Contains(t, testS3Cache.cache, "certs/prod/dummy")
+}
+
+func TestCacheWithInvalidEnvironment(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	ctx := context.Background()
+
+	cache := &Cache{s3: testS3Cache, RequireEnvironment: true}
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, ErrInvalidEnvironment, err)
+	assert.Equal(t, ErrInvalidEnvironment, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, ErrInvalidEnvironment, cache.Delete(ctx, "dummy"))
+
+	cache = &Cache{s3: testS3Cache, Environment: "dev/eu"}
+	assert.Equal(t, ErrInvalidEnvironment, cache.Put(ctx, "dummy", []byte{1}))
+
+	assert.Empty(t, testS3Cache.cache)
+}
+
+func TestCacheHashKeys(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", HashKeys: true}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "example.org")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+
+	key := "certs/" + hashKey("example.org")
+	assert.Len(t, key, len("certs/")+64)
+	assert.Contains(t, testS3Cache.cache, key)
+	assert.Equal(t, "example.org", aws.StringValue(testS3Cache.meta[key][keyMetadataKey]))
+
+	b, err := cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	assert.NoError(t, cache.Delete(ctx, "example.org"))
+	assert.Empty(t, testS3Cache.cache)
+}
+
+func TestCacheKeySecret(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", HashKeys: true, KeySecret: []byte("secret")}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+
+	key := "certs/" + hmacKey([]byte("secret"), "example.org")
+	assert.NotEqual(t, "certs/"+hashKey("example.org"), key)
+	assert.Contains(t, testS3Cache.cache, key)
+	assert.NotContains(t, testS3Cache.meta[key], keyMetadataKey)
+	for k := range testS3Cache.cache {
+		assert.NotContains(t, k, "example")
+	}
+
+	b, err := cache.Get(ctx, "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	other := &Cache{s3: testS3Cache, Prefix: "certs/", KeySecret: []byte("other")}
+	_, err = other.Get(ctx, "example.org")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	assert.NoError(t, cache.Delete(ctx, "example.org"))
+	assert.Empty(t, testS3Cache.cache)
+}
+
+func TestCacheKeyFunc(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", HashKeys: true, KeyFunc: func(key string) string {
+		return strings.Replace(key, "+", "_", -1)
+	}}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org+rsa", []byte{1}))
+	assert.Equal(t, map[string][]byte{"certs/example.org_rsa": {1}}, testS3Cache.cache)
+	assert.NotContains(t, testS3Cache.meta["certs/example.org_rsa"], keyMetadataKey)
+
+	b, err := cache.Get(ctx, "example.org+rsa")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	assert.NoError(t, cache.Delete(ctx, "example.org+rsa"))
+	assert.Empty(t, testS3Cache.cache)
+}
+
+func TestCacheStorageClassFor(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, StorageClassFor: func(key string) string {
+		if key == "acme_account+key" {
+			return s3.StorageClassStandardIa
+		}
+		return ""
+	}}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{2}))
+	assert.Equal(t, s3.StorageClassStandardIa, aws.StringValue(testS3Cache.inputs["acme_account+key"].StorageClass))
+	assert.Nil(t, testS3Cache.inputs["example.org"].StorageClass)
+}
+
+func TestCacheACL(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Nil(t, testS3Cache.inputs["dummy"].ACL)
+
+	cache.ACL = s3.ObjectCannedACLPrivate
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, s3.ObjectCannedACLPrivate, aws.StringValue(testS3Cache.inputs["dummy"].ACL))
+
+	cache.ACL = "secret"
+	assert.Error(t, cache.Put(ctx, "dummy", []byte{1}))
+}
+
+func TestCacheContentType(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "example.org+http-01", []byte{1}))
+	assert.Equal(t, "application/x-pem-file", aws.StringValue(testS3Cache.inputs["example.org"].ContentType))
+	assert.Equal(t, "application/x-pem-file", aws.StringValue(testS3Cache.inputs["acme_account+key"].ContentType))
+	assert.Equal(t, "application/octet-stream", aws.StringValue(testS3Cache.inputs["example.org+http-01"].ContentType))
+
+	cache.ContentType = "text/plain"
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{2}))
+	assert.Equal(t, "text/plain", aws.StringValue(testS3Cache.inputs["example.org"].ContentType))
+}
+
+func TestCacheStorageClass(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.Nil(t, testS3Cache.inputs["example.org"].StorageClass)
+
+	cache.StorageClass = s3.StorageClassIntelligentTiering
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.Equal(t, s3.StorageClassIntelligentTiering, aws.StringValue(testS3Cache.inputs["example.org"].StorageClass))
+
+	cache.StorageClassFor = func(key string) string {
+		if key == "acme_account+key" {
+			return s3.StorageClassGlacierIr
+		}
+		return ""
+	}
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{2}))
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.Equal(t, s3.StorageClassGlacierIr, aws.StringValue(testS3Cache.inputs["acme_account+key"].StorageClass))
+	assert.Equal(t, s3.StorageClassIntelligentTiering, aws.StringValue(testS3Cache.inputs["example.org"].StorageClass))
+
+	cache.StorageClass = "COLD"
+	assert.Error(t, cache.Put(ctx, "example.com", []byte{3}))
+	assert.NotContains(t, testS3Cache.cache, "example.com")
+}
+
+func TestCacheCriticalKey(t *testing.T) {
+	testS3Cache := &countingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, CriticalKey: func(key string) bool {
+		return key == "acme_account+key"
+	}}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.Equal(t, 0, testS3Cache.gets)
+
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{1}))
+	assert.Equal(t, 1, testS3Cache.gets)
+
+	testS3Cache.corrupt = 1
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{2}))
+	assert.Equal(t, 3, testS3Cache.gets)
+	assert.Equal(t, []byte{2}, testS3Cache.cache["acme_account+key"])
+
+	testS3Cache.corrupt = criticalPutAttempts
+	assert.Equal(t, ErrVerifyFailed, cache.Put(ctx, "acme_account+key", []byte{3}))
+}
+
+type truncatingS3 struct {
+	*testS3
+}
+
+func (t *truncatingS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	resp, err := t.testS3.GetObjectWithContext(ctx, input, opts...)
+	if err == nil {
+		resp.ContentLength = aws.Int64(int64(len(t.cache[*input.Key]) + 1))
+	}
+	return resp, err
+}
+
+func TestCacheTruncated(t *testing.T) {
+	cache := &Cache{s3: &truncatingS3{testS3: &testS3{cache: map[string][]byte{"dummy": {1}}}}}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, ErrTruncated, err)
+
+	_, err = cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+// erroringS3 fails every request with err.
+type erroringS3 struct {
+	*testS3
+	err error
+}
+
+func (e *erroringS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return nil, e.err
+}
+
+func (e *erroringS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return nil, e.err
+}
+
+func (e *erroringS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	return nil, e.err
+}
+
+func TestCacheErrors(t *testing.T) {
+	errTest := errors.New("test")
+	invalid := awserr.NewRequestFailure(awserr.New("InvalidRequest", "Invalid Request", nil), http.StatusBadRequest, "")
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		err      error
+		expected error
+	}{
+		{awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), http.StatusNotFound, ""), autocert.ErrCacheMiss},
+		{awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), autocert.ErrCacheMiss},
+		{awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, ""), ErrAccessDenied},
+		{awserr.New("AccessDenied", "Access Denied", nil), ErrAccessDenied},
+		{awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil), http.StatusNotFound, ""), ErrNoSuchBucket},
+		{errTest, errTest},
+	} {
+		cache := &Cache{s3: &erroringS3{testS3: &testS3{}, err: test.err}}
+		_, err := cache.Get(ctx, "dummy")
+		assert.Equal(t, test.expected, err, "%v", test.err)
+	}
+
+	cache := &Cache{s3: &erroringS3{testS3: &testS3{}, err: invalid}}
+	_, err := cache.Get(ctx, "dummy")
+	assert.EqualError(t, err, "s3cache: get dummy: "+invalid.Error())
+	var reqErr awserr.RequestFailure
+	if assert.True(t, errors.As(err, &reqErr)) {
+		assert.Equal(t, http.StatusBadRequest, reqErr.StatusCode())
+	}
+	assert.EqualError(t, cache.Put(ctx, "dummy", []byte{1}), "s3cache: put dummy: "+invalid.Error())
+	assert.EqualError(t, cache.Delete(ctx, "dummy"), "s3cache: delete dummy: "+invalid.Error())
+
+	noSuchBucket := awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil), http.StatusNotFound, "")
+	cache = &Cache{s3: &erroringS3{testS3: &testS3{}, err: noSuchBucket}}
+	assert.Equal(t, ErrNoSuchBucket, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, ErrNoSuchBucket, cache.Delete(ctx, "dummy"))
+}
+
+// blockingS3 blocks every request until it is canceled.
+type blockingS3 struct {
+	*testS3
+	canceled int
+}
+
+func (b *blockingS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	<-ctx.Done()
+	b.canceled++
+	return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func (b *blockingS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	<-ctx.Done()
+	b.canceled++
+	return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func (b *blockingS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	<-ctx.Done()
+	b.canceled++
+	return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func TestCacheContextCanceled(t *testing.T) {
+	testS3Cache := &blockingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, context.DeadlineExceeded, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, context.DeadlineExceeded, cache.Delete(ctx, "dummy"))
+	assert.Equal(t, 3, testS3Cache.canceled)
+}
+
+func TestCacheSetPrefix(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"a/dummy": {1}, "b/dummy": {2}}}
+	cache := &Cache{s3: testS3Cache, Prefix: "a/"}
+	ctx := context.Background()
+	assert.Equal(t, "a/", cache.GetPrefix())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cache.SetPrefix("b/")
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := cache.Get(ctx, "dummy")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "b/", cache.GetPrefix())
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, b)
+}
+
+func TestCacheReadOnly(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"dummy": {1}}}
+	cache := &Cache{s3: testS3Cache, ReadOnly: true}
+	ctx := context.Background()
+
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+
+	assert.Equal(t, ErrReadOnly, cache.Put(ctx, "dummy", []byte{2}))
+	assert.Equal(t, ErrReadOnly, cache.Delete(ctx, "dummy"))
+	assert.Equal(t, ErrReadOnly, cache.DeleteMany(ctx, []string{"dummy"}))
+	_, err = cache.EnforceSizeLimit(ctx, 0)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.NoError(t, cache.Check(ctx))
+
+	assert.Equal(t, map[string][]byte{"dummy": {1}}, testS3Cache.cache)
+	assert.Empty(t, testS3Cache.inputs)
+}
+
+func TestCacheAllowKey(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, AllowKey: func(key string) bool {
+		return key == "example.org" || key == "acme_account+key"
+	}}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "acme_account+key", []byte{2}))
+	assert.Equal(t, ErrKeyNotAllowed, cache.Put(ctx, "example.com", []byte{3}))
+	assert.NotContains(t, testS3Cache.cache, "example.com")
+}
+
+func TestCacheOnPrefixEmptied(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"other/a": {1}}}
+	var emptied []string
+	cache := &Cache{s3: testS3Cache, Prefix: "tenant/", OnPrefixEmptied: func(ctx context.Context, prefix string) {
+		emptied = append(emptied, prefix)
+	}}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "a", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "b", []byte{2}))
+
+	assert.NoError(t, cache.Delete(ctx, "a"))
+	assert.Empty(t, emptied)
+
+	assert.NoError(t, cache.Delete(ctx, "b"))
+	assert.Equal(t, []string{"tenant/"}, emptied)
+}
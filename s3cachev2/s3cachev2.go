@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+// Package s3cachev2 implements an autocert.Cache to store certificate data
+// within an AWS S3 bucket using aws-sdk-go-v2.
+//
+// It offers the basic behavior of package s3cache, which is built on
+// aws-sdk-go v1, without pulling in v1. Features like MemTTL, Compress or
+// TrackGeneration are only available in s3cache.
+//
+// Keys are built like in s3cache from Prefix, PrefixSeparator and RawPrefix,
+// so both can share a bucket. Caches using s3cache's Environment,
+// MultiTenant, HashKeys or KeyFunc store objects under keys s3cachev2 does
+// not know about.
+//
+// See https://godoc.org/golang.org/x/crypto/acme/autocert
+package s3cachev2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/danilobuerger/autocert-s3-cache/internal/objectkey"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Logger for outputing logs.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SSENone is the SSEType writing objects without requesting server-side
+// encryption, leaving it to the bucket's default encryption.
+const SSENone types.ServerSideEncryption = "none"
+
+// ErrAccessDenied is returned when S3 denies access to the bucket or object.
+var ErrAccessDenied = errors.New("s3cachev2: access denied")
+
+// ErrNoSuchBucket is returned when the bucket does not exist, e.g. because
+// its name is mistyped or it was deleted. S3 responds to that with a 404 as
+// well, which must not be mistaken for a missing object.
+var ErrNoSuchBucket = errors.New("s3cachev2: bucket does not exist")
+
+// API is the part of *s3.Client used by the Cache.
+type API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// Making sure that we're adhering to the autocert.Cache interface.
+var _ autocert.Cache = (*Cache)(nil)
+
+// Cache provides a s3 backend to the autocert cache.
+type Cache struct {
+	// Prefix is used to prefix every objects key cached in s3. A
+	// PrefixSeparator is appended unless the prefix already ends with it,
+	// so "certs" and "certs/" both store keys like "certs/example.org".
+	Prefix string
+	// PrefixSeparator is appended to a prefix not ending with it. Defaults
+	// to "/".
+	PrefixSeparator string
+	// RawPrefix uses the prefix as is, without appending PrefixSeparator.
+	RawPrefix bool
+	// SSEType is the server-side encryption objects are written with, e.g.
+	// types.ServerSideEncryptionAwsKms. If empty, SSE-S3
+	// (types.ServerSideEncryptionAes256) is used like in s3cache. SSENone
+	// never sends the header. Unlike s3cache, stores not supporting SSE-S3
+	// are not detected, they need SSENone.
+	SSEType types.ServerSideEncryption
+	// ExpectedBucketOwner is the account ID that must own the bucket.
+	ExpectedBucketOwner string
+	// Logger is used for debug logging.
+	Logger Logger
+
+	bucket string
+	s3     API
+}
+
+// New creates a new s3 autocert.Cache from an aws-sdk-go-v2 client,
+// usually created by s3.NewFromConfig.
+func New(client API, bucket string) *Cache {
+	return &Cache{
+		bucket: bucket,
+		s3:     client,
+	}
+}
+
+// objectKey returns the key of the object storing key.
+func (c *Cache) objectKey(key string) string {
+	return objectkey.Prefix(c.Prefix, c.PrefixSeparator, c.RawPrefix) + key
+}
+
+// sseType returns the server-side encryption to request, if any.
+func (c *Cache) sseType() types.ServerSideEncryption {
+	switch c.SSEType {
+	case "":
+		return types.ServerSideEncryptionAes256
+	case SSENone:
+		return ""
+	}
+	return c.SSEType
+}
+
+func (c *Cache) log(format string, v ...interface{}) {
+	if c.Logger == nil {
+		return
+	}
+	c.Logger.Printf(format, v...)
+}
+
+// Get returns a certificate data for the specified key.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	key = c.objectKey(key)
+	c.log("S3 Cache Get %s", key)
+
+	resp, err := c.s3.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	})
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+	return data, nil
+}
+
+// Put stores the data in the cache under the specified key.
+func (c *Cache) Put(ctx context.Context, key string, data []byte) error {
+	key = c.objectKey(key)
+	c.log("S3 Cache Put %s", key)
+
+	_, err := c.s3.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(c.bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(data),
+		ServerSideEncryption: c.sseType(),
+		ExpectedBucketOwner:  optionalString(c.ExpectedBucketOwner),
+	})
+	return mapError(ctx, err)
+}
+
+// Delete removes a certificate data from the cache under the specified key.
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	key = c.objectKey(key)
+	c.log("S3 Cache Delete %s", key)
+
+	_, err := c.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: optionalString(c.ExpectedBucketOwner),
+	})
+	return mapError(ctx, err)
+}
+
+// mapError maps err to the errors autocert and callers expect.
+func mapError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if isNoSuchBucket(err) {
+		return ErrNoSuchBucket
+	}
+	if isNotFound(err) {
+		return autocert.ErrCacheMiss
+	}
+	if isAccessDenied(err) {
+		return ErrAccessDenied
+	}
+	return err
+}
+
+func isNoSuchBucket(err error) bool {
+	var noSuchBucket *types.NoSuchBucket
+	return errors.As(err, &noSuchBucket) || errorCode(err) == "NoSuchBucket"
+}
+
+func isNotFound(err error) bool {
+	if isNoSuchBucket(err) {
+		return false
+	}
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return true
+	}
+	return statusCode(err) == http.StatusNotFound || errorCode(err) == "NotFound"
+}
+
+func isAccessDenied(err error) bool {
+	return statusCode(err) == http.StatusForbidden || errorCode(err) == "AccessDenied"
+}
+
+func statusCode(err error) int {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
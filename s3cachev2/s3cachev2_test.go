@@ -0,0 +1,162 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cachev2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type testS3 struct {
+	cache map[string][]byte
+	sse   types.ServerSideEncryption
+	err   error
+}
+
+func (t *testS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	b, ok := t.cache[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (t *testS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	b, err := ioutil.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	t.cache[aws.ToString(params.Key)] = b
+	t.sse = params.ServerSideEncryption
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (t *testS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	delete(t.cache, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestCache(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := New(testS3Cache, "my-bucket")
+	cache.Prefix = "certs/"
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "nonexistent")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	b1 := []byte{1}
+	assert.NoError(t, cache.Put(ctx, "dummy", b1))
+	assert.Equal(t, map[string][]byte{"certs/dummy": b1}, testS3Cache.cache)
+
+	b2, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, b1, b2)
+
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+	_, err = cache.Get(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+func TestCachePrefix(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		prefix    string
+		separator string
+		raw       bool
+		expected  string
+	}{
+		{"", "", false, "dummy"},
+		{"certs", "", false, "certs/dummy"},
+		{"certs/", "", false, "certs/dummy"},
+		{"certs", ":", false, "certs:dummy"},
+		{"certs", "", true, "certsdummy"},
+	} {
+		testS3Cache := &testS3{cache: map[string][]byte{}}
+		cache := New(testS3Cache, "my-bucket")
+		cache.Prefix = test.prefix
+		cache.PrefixSeparator = test.separator
+		cache.RawPrefix = test.raw
+
+		assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+		assert.Contains(t, testS3Cache.cache, test.expected)
+	}
+}
+
+func TestCacheSSE(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		sseType  types.ServerSideEncryption
+		expected types.ServerSideEncryption
+	}{
+		{"", types.ServerSideEncryptionAes256},
+		{types.ServerSideEncryptionAwsKms, types.ServerSideEncryptionAwsKms},
+		{SSENone, ""},
+	} {
+		testS3Cache := &testS3{cache: map[string][]byte{}}
+		cache := New(testS3Cache, "my-bucket")
+		cache.SSEType = test.sseType
+
+		assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+		assert.Equal(t, test.expected, testS3Cache.sse, "%q", test.sseType)
+	}
+}
+
+// notFound returns err as returned by the client with a 404 response.
+func notFound(err error) error {
+	return &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "GetObject",
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusNotFound}},
+				Err:      err,
+			},
+		},
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	errTest := errors.New("test")
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		err      error
+		expected error
+	}{
+		{&smithy.GenericAPIError{Code: "NotFound"}, autocert.ErrCacheMiss},
+		{notFound(&types.NoSuchKey{}), autocert.ErrCacheMiss},
+		{notFound(&types.NoSuchBucket{}), ErrNoSuchBucket},
+		{&smithy.GenericAPIError{Code: "NoSuchBucket"}, ErrNoSuchBucket},
+		{&smithy.GenericAPIError{Code: "AccessDenied"}, ErrAccessDenied},
+		{errTest, errTest},
+	} {
+		cache := New(&testS3{err: test.err}, "my-bucket")
+		_, err := cache.Get(ctx, "dummy")
+		assert.Equal(t, test.expected, err, "%v", test.err)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// EnforceSizeLimit deletes objects until the total size of all objects below
+// the cache's prefix is at most maxBytes. It returns the number of objects
+// deleted. With EvictionStorageClass set, objects are moved to that class
+// instead and only objects in other classes count towards maxBytes.
+//
+// Objects are evicted least recently modified first. The ACME account key,
+// including its stored versions, is never evicted, nor is any object modified
+// less than EvictionMinAge ago. If these leave the cache above maxBytes,
+// EnforceSizeLimit evicts what it can and returns without an error.
+//
+// Eviction deletes certificates that may still be in use. autocert then has
+// to issue them again on the next handshake, which is slow and counts
+// against the CA's rate limits. Set EvictionMinAge to at least the age at
+// which certificates are renewed, e.g. 60 days for Let's Encrypt with
+// autocert's default RenewBefore, so that only certificates that have been
+// superseded or abandoned are evicted.
+func (c *Cache) EnforceSizeLimit(ctx context.Context, maxBytes int64) (int, error) {
+	if c.ReadOnly {
+		return 0, ErrReadOnly
+	}
+
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	c.log("S3 Cache EnforceSizeLimit %s", prefix)
+
+	var objects []*s3.Object
+	err = c.refreshingCredentials(func() error {
+		objects = nil
+		return c.listObjects(ctx, prefix, func(obj *s3.Object) {
+			if c.EvictionStorageClass == "" || aws.StringValue(obj.StorageClass) != c.EvictionStorageClass {
+				objects = append(objects, obj)
+			}
+		})
+	})
+
+	var evicted int
+	if err == nil {
+		skip := func(key string) bool {
+			return c.isAccountObject(strings.TrimPrefix(key, prefix))
+		}
+		for _, obj := range evictionCandidates(objects, maxBytes, c.EvictionMinAge, time.Now(), skip) {
+			key := aws.StringValue(obj.Key)
+			c.log("S3 Cache EnforceSizeLimit evicting %s", key)
+			if err = c.refreshingCredentials(func() error {
+				if c.EvictionStorageClass != "" {
+					return c.transition(ctx, prefix, key)
+				}
+				return c.delete(ctx, key)
+			}); err != nil {
+				break
+			}
+			c.memInvalidate(key)
+			c.forgetWritten(key)
+			evicted++
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return evicted, ctx.Err()
+	}
+
+	if isAccessDenied(err) {
+		return evicted, ErrAccessDenied
+	}
+	return evicted, err
+}
+
+// transition copies the object key below prefix onto itself in
+// EvictionStorageClass. The copy keeps metadata and tags, but SSE and the ACL
+// are applied anew.
+func (c *Cache) transition(ctx context.Context, prefix, key string) error {
+	svc, err := c.client()
+	if err != nil {
+		return err
+	}
+	name, _ := c.cacheKey(strings.TrimPrefix(key, prefix))
+
+	settings := &s3.PutObjectInput{}
+	if err := c.setSSE(ctx, settings, name, c.SSEType != "" || c.sseSupported()); err != nil {
+		return err
+	}
+	if err := c.setACL(settings); err != nil {
+		return err
+	}
+
+	_, err = svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:                    aws.String(c.bucket),
+		Key:                       aws.String(key),
+		CopySource:                aws.String(copySource(c.bucket, key)),
+		ExpectedBucketOwner:       optionalString(c.ExpectedBucketOwner),
+		ExpectedSourceBucketOwner: optionalString(c.ExpectedBucketOwner),
+		ServerSideEncryption:      settings.ServerSideEncryption,
+		SSEKMSKeyId:               settings.SSEKMSKeyId,
+		SSEKMSEncryptionContext:   settings.SSEKMSEncryptionContext,
+		StorageClass:              aws.String(c.EvictionStorageClass),
+		ACL:                       settings.ACL,
+	})
+	return err
+}
+
+// isAccountObject reports whether name, an object key without the cache's
+// prefix, holds the ACME account key or one of its versions.
+func (c *Cache) isAccountObject(name string) bool {
+	for _, key := range accountKeys {
+		if n := c.objectName(key); name == n || strings.HasPrefix(name, n+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// evictionCandidates returns the objects to delete, oldest first, so that the
+// total size of objects drops to at most maxBytes. Objects for which skip
+// returns true or that were modified less than minAge before now are kept.
+func evictionCandidates(objects []*s3.Object, maxBytes int64, minAge time.Duration, now time.Time, skip func(key string) bool) []*s3.Object {
+	var (
+		total    int64
+		eligible []*s3.Object
+	)
+	for _, obj := range objects {
+		total += aws.Int64Value(obj.Size)
+		if skip(aws.StringValue(obj.Key)) || now.Sub(aws.TimeValue(obj.LastModified)) < minAge {
+			continue
+		}
+		eligible = append(eligible, obj)
+	}
+
+	sort.SliceStable(eligible, func(i, j int) bool {
+		return aws.TimeValue(eligible[i].LastModified).Before(aws.TimeValue(eligible[j].LastModified))
+	})
+
+	var candidates []*s3.Object
+	for _, obj := range eligible {
+		if total <= maxBytes {
+			break
+		}
+		candidates = append(candidates, obj)
+		total -= aws.Int64Value(obj.Size)
+	}
+	return candidates
+}
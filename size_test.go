@@ -0,0 +1,122 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestEvictionCandidates(t *testing.T) {
+	now := time.Now()
+	object := func(key string, size int64, age time.Duration) *s3.Object {
+		return &s3.Object{Key: aws.String(key), Size: aws.Int64(size), LastModified: aws.Time(now.Add(-age))}
+	}
+	objects := []*s3.Object{
+		object("new", 10, time.Hour),
+		object("old", 10, 72*time.Hour),
+		object("account", 10, 96*time.Hour),
+		object("older", 10, 48*time.Hour+time.Minute),
+		object("oldest", 10, 96*time.Hour),
+	}
+	skip := func(key string) bool { return key == "account" }
+
+	names := func(objects []*s3.Object) (keys []string) {
+		for _, obj := range objects {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		return keys
+	}
+
+	assert.Empty(t, evictionCandidates(objects, 50, 0, now, skip))
+	assert.Equal(t, []string{"oldest", "old"}, names(evictionCandidates(objects, 30, 0, now, skip)))
+	assert.Equal(t, []string{"oldest", "old", "older", "new"}, names(evictionCandidates(objects, 0, 0, now, skip)))
+	assert.Equal(t, []string{"oldest", "old", "older"}, names(evictionCandidates(objects, 0, 48*time.Hour, now, skip)))
+}
+
+func TestCacheEnforceSizeLimit(t *testing.T) {
+	now := time.Now()
+	testS3Cache := &testS3{
+		cache: map[string][]byte{
+			"prefix/acme_account+key": {1, 2},
+			"prefix/example.org":      {1, 2},
+			"prefix/example.com":      {1, 2},
+			"other/example.net":       {1, 2},
+		},
+		modified: map[string]time.Time{
+			"prefix/acme_account+key": now.Add(-3 * time.Hour),
+			"prefix/example.org":      now.Add(-2 * time.Hour),
+			"prefix/example.com":      now.Add(-time.Hour),
+			"other/example.net":       now.Add(-4 * time.Hour),
+		},
+	}
+	cache := &Cache{s3: testS3Cache, Prefix: "prefix/"}
+
+	evicted, err := cache.EnforceSizeLimit(context.Background(), 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+	assert.NotContains(t, testS3Cache.cache, "prefix/example.org")
+
+	evicted, err = cache.EnforceSizeLimit(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, []byte{1, 2}, testS3Cache.cache["prefix/acme_account+key"])
+	assert.Equal(t, []byte{1, 2}, testS3Cache.cache["other/example.net"])
+}
+
+func TestCacheEnforceSizeLimitMinAge(t *testing.T) {
+	testS3Cache := &testS3{
+		cache:    map[string][]byte{"example.org": {1, 2}},
+		modified: map[string]time.Time{"example.org": time.Now()},
+	}
+	cache := &Cache{s3: testS3Cache, EvictionMinAge: time.Hour}
+
+	evicted, err := cache.EnforceSizeLimit(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, evicted)
+	assert.Contains(t, testS3Cache.cache, "example.org")
+}
+
+func TestCacheEnforceSizeLimitMemory(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"example.org": {1, 2}}}
+	cache := &Cache{s3: testS3Cache, MemTTL: time.Hour}
+
+	data, err := cache.Get(context.Background(), "example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2}, data)
+
+	evicted, err := cache.EnforceSizeLimit(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+
+	_, err = cache.Get(context.Background(), "example.org")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+}
+
+func TestCacheEnforceSizeLimitStorageClass(t *testing.T) {
+	testS3Cache := &copyingS3{testS3: &testS3{
+		cache: map[string][]byte{"example.org": {1, 2}, "example.com": {1, 2}},
+		meta:  map[string]map[string]*string{},
+		modified: map[string]time.Time{
+			"example.org": time.Now().Add(-time.Hour),
+			"example.com": time.Now(),
+		},
+	}}
+	cache := &Cache{s3: testS3Cache, EvictionStorageClass: s3.StorageClassStandardIa}
+
+	evicted, err := cache.EnforceSizeLimit(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, []byte{1, 2}, testS3Cache.cache["example.org"])
+	if assert.Len(t, testS3Cache.copies, 1) {
+		assert.Equal(t, "example.org", aws.StringValue(testS3Cache.copies[0].Key))
+		assert.Equal(t, "/example.org", aws.StringValue(testS3Cache.copies[0].CopySource))
+		assert.Equal(t, s3.StorageClassStandardIa, aws.StringValue(testS3Cache.copies[0].StorageClass))
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// SSENone is the SSEType writing objects without requesting server-side
+// encryption, so the bucket's default encryption applies.
+const SSENone = "none"
+
+// errKMSKeyIDWithoutKMS is returned by New and Put if KMSKeyID is set
+// without SSE-KMS.
+var errKMSKeyIDWithoutKMS = errors.New("s3cache: KMSKeyID requires SSEType " + s3.ServerSideEncryptionAwsKms)
+
+// errEncryptionContextWithoutKMS is returned by New and Put if
+// EncryptionContext is set without SSE-KMS.
+var errEncryptionContextWithoutKMS = errors.New("s3cache: EncryptionContext requires SSEType " + s3.ServerSideEncryptionAwsKms)
+
+// SSE is the server-side encryption WithSSE sets, see the SSEType, KMSKeyID
+// and EncryptionContext fields of Cache.
+type SSE struct {
+	Type              string
+	KMSKeyID          string
+	EncryptionContext map[string]string
+}
+
+// validateSSE returns an error if the server-side encryption settings are
+// inconsistent, whether or not encryption is requested for a write.
+func validateSSE(sseType, kmsKeyID string, encryptionContext map[string]string) error {
+	switch sseType {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms, SSENone:
+	default:
+		return fmt.Errorf("s3cache: unsupported SSEType %q", sseType)
+	}
+	if kmsKeyID != "" && sseType != s3.ServerSideEncryptionAwsKms {
+		return errKMSKeyIDWithoutKMS
+	}
+	if len(encryptionContext) > 0 && sseType != s3.ServerSideEncryptionAwsKms {
+		return errEncryptionContextWithoutKMS
+	}
+	return nil
+}
+
+// setSSE sets the server-side encryption of SSEType for the object of the
+// cache key name on input, if sse is true. The settings are validated
+// either way, so that they fail on every store and not only on those that
+// support encryption.
+func (c *Cache) setSSE(ctx context.Context, input *s3.PutObjectInput, name string, sse bool) error {
+	encryptionContext := c.encryptionContext(ctx, name)
+	if err := validateSSE(c.SSEType, c.KMSKeyID, encryptionContext); err != nil {
+		return err
+	}
+	if !sse {
+		return nil
+	}
+
+	switch c.SSEType {
+	case "", s3.ServerSideEncryptionAes256:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAes256)
+	case s3.ServerSideEncryptionAwsKms:
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = optionalString(c.KMSKeyID)
+		if len(encryptionContext) > 0 {
+			b, err := json.Marshal(encryptionContext)
+			if err != nil {
+				return err
+			}
+			input.SSEKMSEncryptionContext = aws.String(base64.StdEncoding.EncodeToString(b))
+		}
+	}
+	return nil
+}
+
+// encryptionContext returns EncryptionContext merged with the entries
+// EncryptionContextFor returns for the cache key name.
+func (c *Cache) encryptionContext(ctx context.Context, name string) map[string]string {
+	if c.EncryptionContextFor == nil {
+		return c.EncryptionContext
+	}
+	extra := c.EncryptionContextFor(ctx, name)
+	if len(extra) == 0 {
+		return c.EncryptionContext
+	}
+
+	merged := make(map[string]string, len(c.EncryptionContext)+len(extra))
+	for k, v := range c.EncryptionContext {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (c *Cache) sseSupported() bool {
+	return atomic.LoadInt32(&c.noSSE) == 0
+}
+
+func (c *Cache) disableSSE() {
+	atomic.StoreInt32(&c.noSSE, 1)
+}
+
+// isSSEUnsupported reports whether err rejects a request because the store
+// does not implement server-side encryption, e.g. MinIO without a KMS:
+// "NotImplemented: Server side encryption specified but KMS is not configured".
+// The message is checked as well, since stores also use these codes for
+// other headers they don't support, like conditional writes.
+func isSSEUnsupported(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	switch awsErr.Code() {
+	case "NotImplemented", "InvalidArgument", "InvalidRequest":
+		return strings.Contains(strings.ToLower(awsErr.Message()), "encryption")
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// noSSES3 rejects every PutObject requesting server-side encryption.
+type noSSES3 struct {
+	*testS3
+	rejected int
+}
+
+func (n *noSSES3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if input.ServerSideEncryption != nil {
+		n.rejected++
+		return nil, awserr.NewRequestFailure(awserr.New("NotImplemented", "Server side encryption specified but KMS is not configured", nil), http.StatusNotImplemented, "")
+	}
+	return n.testS3.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestCachePutWithoutSSE(t *testing.T) {
+	testS3Cache := &noSSES3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "a", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "b", []byte{2}))
+	assert.Equal(t, 1, testS3Cache.rejected)
+
+	b, err := cache.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+}
+
+func TestIsSSEUnsupported(t *testing.T) {
+	assert.True(t, isSSEUnsupported(awserr.New("InvalidArgument", "Server Side Encryption is not supported", nil)))
+	assert.False(t, isSSEUnsupported(awserr.New("NotImplemented", "A header you provided implies functionality that is not implemented", nil)))
+	assert.False(t, isSSEUnsupported(awserr.New("AccessDenied", "Access Denied: encryption required", nil)))
+	assert.False(t, isSSEUnsupported(nil))
+}
+
+func TestCacheSSEType(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, s3.ServerSideEncryptionAes256, aws.StringValue(testS3Cache.inputs["dummy"].ServerSideEncryption))
+
+	cache.SSEType, cache.KMSKeyID = s3.ServerSideEncryptionAwsKms, "alias/certs"
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(testS3Cache.inputs["dummy"].ServerSideEncryption))
+	assert.Equal(t, "alias/certs", aws.StringValue(testS3Cache.inputs["dummy"].SSEKMSKeyId))
+
+	cache.SSEType, cache.KMSKeyID = SSENone, ""
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Nil(t, testS3Cache.inputs["dummy"].ServerSideEncryption)
+	assert.Nil(t, testS3Cache.inputs["dummy"].SSEKMSKeyId)
+
+	cache.SSEType, cache.KMSKeyID = s3.ServerSideEncryptionAes256, "alias/certs"
+	assert.Equal(t, errKMSKeyIDWithoutKMS, cache.Put(ctx, "dummy", []byte{1}))
+
+	cache.SSEType, cache.KMSKeyID = "aws:kms:dsse", ""
+	assert.Error(t, cache.Put(ctx, "dummy", []byte{1}))
+}
+
+func TestCacheEncryptionContext(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{
+		s3:                testS3Cache,
+		SSEType:           s3.ServerSideEncryptionAwsKms,
+		EncryptionContext: map[string]string{"service": "autocert"},
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, "eyJzZXJ2aWNlIjoiYXV0b2NlcnQifQ==", aws.StringValue(testS3Cache.inputs["dummy"].SSEKMSEncryptionContext))
+
+	cache.SSEType = SSENone
+	assert.Equal(t, errEncryptionContextWithoutKMS, cache.Put(ctx, "dummy", []byte{1}))
+}
+
+func TestCacheEncryptionContextFor(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{
+		s3:                testS3Cache,
+		SSEType:           s3.ServerSideEncryptionAwsKms,
+		EncryptionContext: map[string]string{"service": "autocert", "tenant": "none"},
+		EncryptionContextFor: func(ctx context.Context, key string) map[string]string {
+			if tenant, ok := TenantFromContext(ctx); ok {
+				return map[string]string{"tenant": tenant, "key": key}
+			}
+			return nil
+		},
+	}
+	encryptionContext := func() map[string]string {
+		b, err := base64.StdEncoding.DecodeString(aws.StringValue(testS3Cache.inputs["dummy"].SSEKMSEncryptionContext))
+		assert.NoError(t, err)
+		var m map[string]string
+		assert.NoError(t, json.Unmarshal(b, &m))
+		return m
+	}
+
+	assert.NoError(t, cache.Put(WithTenant(context.Background(), "acme"), "dummy", []byte{1}))
+	assert.Equal(t, map[string]string{"service": "autocert", "tenant": "acme", "key": "dummy"}, encryptionContext())
+	assert.Equal(t, map[string]string{"service": "autocert", "tenant": "none"}, cache.EncryptionContext)
+
+	assert.NoError(t, cache.Put(context.Background(), "dummy", []byte{1}))
+	assert.Equal(t, map[string]string{"service": "autocert", "tenant": "none"}, encryptionContext())
+
+	cache.SSEType, cache.EncryptionContext = SSENone, nil
+	assert.NoError(t, cache.Put(context.Background(), "dummy", []byte{1}))
+	assert.Equal(t, errEncryptionContextWithoutKMS, cache.Put(WithTenant(context.Background(), "acme"), "dummy", []byte{1}))
+}
+
+func TestCachePutExplicitSSE(t *testing.T) {
+	testS3Cache := &noSSES3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, SSEType: s3.ServerSideEncryptionAes256}
+
+	assert.Error(t, cache.Put(context.Background(), "dummy", []byte{1}))
+	assert.Empty(t, testS3Cache.cache)
+}
+
+func TestCacheSSENone(t *testing.T) {
+	testS3Cache := &noSSES3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, SSEType: SSENone}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	b, err := cache.Get(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, b)
+	assert.NoError(t, cache.Delete(ctx, "dummy"))
+	assert.Equal(t, 0, testS3Cache.rejected)
+}
+
+func TestCacheSSEValidatedWithoutSSE(t *testing.T) {
+	testS3Cache := &noSSES3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	// The store does not support encryption, so no header is sent anymore.
+	assert.NoError(t, cache.Put(ctx, "a", []byte{1}))
+	assert.False(t, cache.sseSupported())
+
+	cache.KMSKeyID = "alias/certs"
+	assert.Equal(t, errKMSKeyIDWithoutKMS, cache.Put(ctx, "b", []byte{2}))
+	cache.KMSKeyID, cache.EncryptionContext = "", map[string]string{"service": "autocert"}
+	assert.Equal(t, errEncryptionContextWithoutKMS, cache.Put(ctx, "b", []byte{2}))
+	assert.NotContains(t, testS3Cache.cache, "b")
+}
+
+func TestNewValidatesSSE(t *testing.T) {
+	calls, restore := stubSession(nil)
+	defer restore()
+
+	_, err := New("eu-west-1", "my-bucket", WithSSE(SSE{KMSKeyID: "alias/certs"}))
+	assert.Equal(t, errKMSKeyIDWithoutKMS, err)
+	_, err = New("eu-west-1", "my-bucket", WithSSE(SSE{Type: SSENone, EncryptionContext: map[string]string{"service": "autocert"}}))
+	assert.Equal(t, errEncryptionContextWithoutKMS, err)
+	_, err = New("eu-west-1", "my-bucket", WithSSE(SSE{Type: "aws:kms:dsse"}))
+	assert.EqualError(t, err, `s3cache: unsupported SSEType "aws:kms:dsse"`)
+	assert.Equal(t, 0, *calls)
+
+	cache, err := New("eu-west-1", "my-bucket", WithSSE(SSE{Type: s3.ServerSideEncryptionAwsKms, KMSKeyID: "alias/certs"}), WithLazyInit(true))
+	assert.NoError(t, err)
+	assert.Equal(t, s3.ServerSideEncryptionAwsKms, cache.SSEType)
+	assert.Equal(t, "alias/certs", cache.KMSKeyID)
+}
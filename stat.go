@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ObjectInfo describes the object stored under a key.
+type ObjectInfo struct {
+	// Size is the size of the object in bytes, after compression and
+	// client-side encryption.
+	Size int64
+	// LastModified is the time S3 last wrote the object.
+	LastModified time.Time
+	// ETag is the entity tag of the object, including its quotes.
+	ETag string
+	// StorageClass is the storage class of the object. S3 reports an empty
+	// class for STANDARD.
+	StorageClass string
+}
+
+// Stat returns information about the object under the specified key without
+// reading its data, e.g. to alert on certificates that have not been renewed
+// in time. If there's no such key, Stat returns autocert.ErrCacheMiss.
+func (c *Cache) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	c.log("S3 Cache Stat %s", key)
+
+	var head *s3.HeadObjectOutput
+	err = c.refreshingCredentials(func() (err error) {
+		head, err = c.head(ctx, key)
+		return err
+	})
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if isNotFound(err) {
+		return nil, autocert.ErrCacheMiss
+	}
+	if isAccessDenied(err) {
+		return nil, ErrAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Size:         aws.Int64Value(head.ContentLength),
+		LastModified: aws.TimeValue(head.LastModified),
+		ETag:         aws.StringValue(head.ETag),
+		StorageClass: aws.StringValue(head.StorageClass),
+	}, nil
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCacheStat(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "a/", StorageClass: s3.StorageClassStandardIa}
+	ctx := context.Background()
+
+	_, err := cache.Stat(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1, 2, 3}))
+	modified := time.Date(2016, 12, 1, 10, 0, 0, 0, time.UTC)
+	testS3Cache.modified["a/dummy"] = modified
+	info, err := cache.Stat(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, &ObjectInfo{
+		Size:         3,
+		LastModified: modified,
+		ETag:         testS3Cache.etag("a/dummy"),
+		StorageClass: s3.StorageClassStandardIa,
+	}, info)
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// setStorageClass sets the storage class of the cache key name on input.
+func (c *Cache) setStorageClass(input *s3.PutObjectInput, name string) error {
+	class := c.StorageClass
+	if c.StorageClassFor != nil {
+		if v := c.StorageClassFor(name); v != "" {
+			class = v
+		}
+	}
+	if class == "" {
+		return nil
+	}
+
+	for _, v := range s3.StorageClass_Values() {
+		if class == v {
+			input.StorageClass = optionalString(class)
+			return nil
+		}
+	}
+	return fmt.Errorf("s3cache: unknown storage class %q", class)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Levels of the records passed to a StructuredLogger.
+const (
+	LevelDebug = "debug"
+	LevelError = "error"
+)
+
+// StructuredLogger logs records made of a message and key/value fields,
+// e.g. as JSON for a log aggregator.
+//
+// Every Get, Put and Delete produces a record with the message
+// "S3 Cache Get" (Put, Delete) and the fields "operation", "key" and
+// "duration" (a time.Duration), plus "label" if MetricsLabel returns one.
+// Failed operations are logged at LevelError
+// with the fields "error" and, if the error came from an S3 request,
+// "request_id" and "extended_request_id". Misses are logged at LevelDebug
+// with "miss" set to true. All other messages are logged without fields.
+type StructuredLogger interface {
+	Log(level, msg string, fields map[string]interface{})
+}
+
+func (c *Cache) logRecord(op, key, label string, start time.Time, err error) {
+	level := LevelDebug
+	fields := map[string]interface{}{
+		"operation": op,
+		"key":       key,
+		"duration":  time.Since(start),
+	}
+	if label != "" {
+		fields["label"] = label
+	}
+	switch {
+	case err == autocert.ErrCacheMiss:
+		fields["miss"] = true
+	case err != nil:
+		level = LevelError
+		fields["error"] = err.Error()
+		if requestID, extendedRequestID := RequestID(err); requestID != "" {
+			fields["request_id"] = requestID
+			fields["extended_request_id"] = extendedRequestID
+		}
+	}
+	c.StructuredLogger.Log(level, "S3 Cache "+op, fields)
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRecord struct {
+	level, msg string
+	fields     map[string]interface{}
+}
+
+type testStructuredLogger struct {
+	records []testRecord
+}
+
+func (l *testStructuredLogger) Log(level, msg string, fields map[string]interface{}) {
+	l.records = append(l.records, testRecord{level, msg, fields})
+}
+
+// last returns the last record and drops the duration, which varies.
+func (l *testStructuredLogger) last() testRecord {
+	r := l.records[len(l.records)-1]
+	delete(r.fields, "duration")
+	return r
+}
+
+func TestStructuredLogger(t *testing.T) {
+	l := &testStructuredLogger{}
+	logger := &testLogger{}
+	cache := &Cache{s3: &testS3{cache: map[string][]byte{}}, StructuredLogger: l, Logger: logger}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, testRecord{LevelDebug, "S3 Cache Put dummy", nil}, l.records[0])
+	assert.Contains(t, l.records[len(l.records)-1].fields, "duration")
+	assert.Equal(t, testRecord{LevelDebug, "S3 Cache Put", map[string]interface{}{
+		"operation": "Put",
+		"key":       "dummy",
+	}}, l.last())
+
+	_, err := cache.Get(ctx, "nonexistent")
+	assert.Error(t, err)
+	assert.Equal(t, testRecord{LevelDebug, "S3 Cache Get", map[string]interface{}{
+		"operation": "Get",
+		"key":       "nonexistent",
+		"miss":      true,
+	}}, l.last())
+
+	invalid := awserr.NewRequestFailure(awserr.New("InvalidRequest", "Invalid Request", nil), http.StatusBadRequest, "REQ123")
+	cache.s3 = &erroringS3{testS3: &testS3{}, err: invalid}
+	err = cache.Delete(ctx, "dummy")
+	assert.Equal(t, testRecord{LevelError, "S3 Cache Delete", map[string]interface{}{
+		"operation":           "Delete",
+		"key":                 "dummy",
+		"error":               err.Error(),
+		"request_id":          "REQ123",
+		"extended_request_id": "",
+	}}, l.last())
+
+	assert.False(t, logger.called)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// See https://docs.aws.amazon.com/AmazonS3/latest/userguide/object-tagging.html
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// setTagging sets Tags on input.
+func (c *Cache) setTagging(input *s3.PutObjectInput) error {
+	if len(c.Tags) == 0 {
+		return nil
+	}
+	if err := validateTags(c.Tags); err != nil {
+		return err
+	}
+
+	tags := url.Values{}
+	for k, v := range c.Tags {
+		tags.Set(k, v)
+	}
+	input.Tagging = aws.String(tags.Encode())
+	return nil
+}
+
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("s3cache: invalid tags: at most %d tags are allowed, got %d", maxTags, len(tags))
+	}
+	for k, v := range tags {
+		switch {
+		case k == "":
+			return fmt.Errorf("s3cache: invalid tags: key must not be empty")
+		case utf8.RuneCountInString(k) > maxTagKeyLength:
+			return fmt.Errorf("s3cache: invalid tag %q: key must be at most %d characters long", k, maxTagKeyLength)
+		case utf8.RuneCountInString(v) > maxTagValueLength:
+			return fmt.Errorf("s3cache: invalid tag %q: value must be at most %d characters long", k, maxTagValueLength)
+		case strings.HasPrefix(strings.ToLower(k), "aws:"):
+			return fmt.Errorf("s3cache: invalid tag %q: key must not use the reserved prefix aws:", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheTags(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Nil(t, testS3Cache.inputs["dummy"].Tagging)
+
+	cache.Tags = map[string]string{"app": "web", "env": "prod & test"}
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, "app=web&env=prod+%26+test", aws.StringValue(testS3Cache.inputs["dummy"].Tagging))
+}
+
+func TestCacheInvalidTags(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	ctx := context.Background()
+
+	tooMany := map[string]string{}
+	for i := 0; i <= maxTags; i++ {
+		tooMany[fmt.Sprint(i)] = ""
+	}
+
+	for _, tags := range []map[string]string{
+		tooMany,
+		{"": "web"},
+		{strings.Repeat("k", maxTagKeyLength+1): "web"},
+		{"app": strings.Repeat("v", maxTagValueLength+1)},
+		{"aws:app": "web"},
+	} {
+		cache := &Cache{s3: testS3Cache, Tags: tags}
+		assert.Error(t, cache.Put(ctx, "dummy", []byte{1}))
+	}
+	assert.Empty(t, testS3Cache.cache)
+
+	cache := &Cache{s3: testS3Cache, Tags: map[string]string{
+		strings.Repeat("k", maxTagKeyLength): strings.Repeat("v", maxTagValueLength),
+	}}
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrInvalidTenant is returned when MultiTenant is set and the context of an
+// operation carries no tenant, or one containing a slash.
+var ErrInvalidTenant = errors.New("s3cache: missing or invalid tenant")
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenant, which a Cache with
+// MultiTenant set stores all keys of operations with that context under.
+// The tenant must not be empty or contain slashes.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by WithTenant, if any.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCacheMultiTenant(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", Environment: "prod", MultiTenant: true}
+	a := WithTenant(context.Background(), "a")
+	b := WithTenant(context.Background(), "b")
+
+	assert.NoError(t, cache.Put(a, "dummy", []byte{1}))
+	assert.NoError(t, cache.Put(b, "dummy", []byte{2}))
+	assert.Equal(t, map[string][]byte{"certs/prod/a/dummy": {1}, "certs/prod/b/dummy": {2}}, testS3Cache.cache)
+
+	data, err := cache.Get(a, "dummy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1}, data)
+
+	assert.NoError(t, cache.Delete(b, "dummy"))
+	_, err = cache.Get(b, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+	_, err = cache.Get(a, "dummy")
+	assert.NoError(t, err)
+}
+
+func TestCacheMultiTenantInvalid(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, MultiTenant: true}
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		WithTenant(context.Background(), ""),
+		WithTenant(context.Background(), "a/b"),
+	} {
+		_, err := cache.Get(ctx, "dummy")
+		assert.Equal(t, ErrInvalidTenant, err)
+		assert.Equal(t, ErrInvalidTenant, cache.Put(ctx, "dummy", []byte{1}))
+		assert.Equal(t, ErrInvalidTenant, cache.Delete(ctx, "dummy"))
+	}
+	assert.Empty(t, testS3Cache.cache)
+}
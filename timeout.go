@@ -0,0 +1,14 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import "context"
+
+// withDefaultTimeout returns ctx bounded by DefaultTimeout. The deadline of
+// ctx is kept if it is sooner.
+func (c *Cache) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.DefaultTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.DefaultTimeout)
+}
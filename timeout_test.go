@@ -0,0 +1,34 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheDefaultTimeout(t *testing.T) {
+	testS3Cache := &blockingS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache, DefaultTimeout: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, context.DeadlineExceeded, cache.Put(ctx, "dummy", []byte{1}))
+	assert.Equal(t, context.DeadlineExceeded, cache.Delete(ctx, "dummy"))
+	assert.Equal(t, 3, testS3Cache.canceled)
+}
+
+func TestCacheDefaultTimeoutSooner(t *testing.T) {
+	cache := &Cache{s3: &blockingS3{testS3: &testS3{cache: map[string][]byte{}}}, DefaultTimeout: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cache.Get(ctx, "dummy")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const updatedAtMetadataKey = "Updated-At"
+
+// UpdatedAt returns when the object under the specified key was last
+// written by Put, as stored in its x-amz-meta-updated-at metadata. Objects
+// written before the metadata was introduced report their LastModified
+// time instead, which copies and restores made outside of the cache change
+// as well.
+func (c *Cache) UpdatedAt(ctx context.Context, key string) (time.Time, error) {
+	key, err := c.objectKey(ctx, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.log("S3 Cache UpdatedAt %s", key)
+
+	var head *s3.HeadObjectOutput
+	err = c.refreshingCredentials(func() (err error) {
+		head, err = c.head(ctx, key)
+		return err
+	})
+	if err != nil && ctx.Err() != nil {
+		return time.Time{}, ctx.Err()
+	}
+
+	if isNotFound(err) {
+		return time.Time{}, autocert.ErrCacheMiss
+	}
+	if isAccessDenied(err) {
+		return time.Time{}, ErrAccessDenied
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return parseUpdatedAt(head)
+}
+
+func parseUpdatedAt(head *s3.HeadObjectOutput) (time.Time, error) {
+	v, ok := head.Metadata[updatedAtMetadataKey]
+	if !ok {
+		return aws.TimeValue(head.LastModified), nil
+	}
+	return time.Parse(time.RFC3339, aws.StringValue(v))
+}
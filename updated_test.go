@@ -0,0 +1,36 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCacheUpdatedAt(t *testing.T) {
+	legacy := time.Date(2016, 12, 1, 10, 0, 0, 0, time.UTC)
+	testS3Cache := &testS3{
+		cache:    map[string][]byte{"legacy": {1}},
+		modified: map[string]time.Time{"legacy": legacy},
+	}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	_, err := cache.UpdatedAt(ctx, "dummy")
+	assert.Equal(t, autocert.ErrCacheMiss, err)
+
+	before := time.Now().Truncate(time.Second)
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte{1}))
+	updated, err := cache.UpdatedAt(ctx, "dummy")
+	assert.NoError(t, err)
+	assert.False(t, updated.Before(before))
+	assert.False(t, updated.After(time.Now()))
+
+	updated, err = cache.UpdatedAt(ctx, "legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, legacy, updated)
+}
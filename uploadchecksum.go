@@ -0,0 +1,50 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// setUploadChecksum sets the UploadChecksum algorithm and the checksum of
+// data computed with it on input.
+func (c *Cache) setUploadChecksum(input *s3.PutObjectInput, data []byte) error {
+	if c.UploadChecksum == "" {
+		return nil
+	}
+
+	sum := func(h hash.Hash) *string {
+		h.Write(data)
+		return aws.String(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	}
+
+	switch c.UploadChecksum {
+	case s3.ChecksumAlgorithmCrc32:
+		input.ChecksumCRC32 = crc32Checksum(crc32.IEEETable, data)
+	case s3.ChecksumAlgorithmCrc32c:
+		input.ChecksumCRC32C = crc32Checksum(crc32.MakeTable(crc32.Castagnoli), data)
+	case s3.ChecksumAlgorithmSha1:
+		input.ChecksumSHA1 = sum(sha1.New())
+	case s3.ChecksumAlgorithmSha256:
+		input.ChecksumSHA256 = sum(sha256.New())
+	default:
+		return fmt.Errorf("s3cache: unsupported upload checksum algorithm %q", c.UploadChecksum)
+	}
+	input.ChecksumAlgorithm = aws.String(c.UploadChecksum)
+	return nil
+}
+
+func crc32Checksum(table *crc32.Table, data []byte) *string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, crc32.Checksum(data, table))
+	return aws.String(base64.StdEncoding.EncodeToString(b))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// checksumS3 rejects every PutObject without a valid CRC32 checksum, like a
+// bucket policy requiring one.
+type checksumS3 struct {
+	*testS3
+}
+
+func (c *checksumS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := base64.StdEncoding.DecodeString(aws.StringValue(input.ChecksumCRC32))
+	if aws.StringValue(input.ChecksumAlgorithm) != s3.ChecksumAlgorithmCrc32 || err != nil || len(sum) != 4 ||
+		binary.BigEndian.Uint32(sum) != crc32.ChecksumIEEE(data) {
+		return nil, awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+	}
+	input.Body = bytes.NewReader(data)
+	return c.testS3.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestCacheUploadChecksum(t *testing.T) {
+	testS3Cache := &checksumS3{testS3: &testS3{cache: map[string][]byte{}}}
+	cache := &Cache{s3: testS3Cache}
+	ctx := context.Background()
+
+	assert.Equal(t, ErrAccessDenied, cache.Put(ctx, "dummy", []byte("data")))
+
+	cache.UploadChecksum = s3.ChecksumAlgorithmCrc32
+	assert.NoError(t, cache.Put(ctx, "dummy", []byte("data")))
+	assert.Equal(t, []byte("data"), testS3Cache.cache["dummy"])
+
+	cache.UploadChecksum = "MD5"
+	assert.Error(t, cache.Put(ctx, "dummy", []byte("data")))
+}
+
+func TestSetUploadChecksum(t *testing.T) {
+	for algorithm, expected := range map[string]string{
+		s3.ChecksumAlgorithmCrc32:  "rfPzYw==",
+		s3.ChecksumAlgorithmCrc32c: "rth90Q==",
+		s3.ChecksumAlgorithmSha1:   "oXyaqmHoChv3HQ2FCvTluqmAC70=",
+		s3.ChecksumAlgorithmSha256: "Om6weQ85rIfJTzhWst0sXREOaBFgImGpqSPTuyOtyLc=",
+	} {
+		cache := &Cache{UploadChecksum: algorithm}
+		input := &s3.PutObjectInput{}
+		assert.NoError(t, cache.setUploadChecksum(input, []byte("data")))
+		assert.Equal(t, algorithm, aws.StringValue(input.ChecksumAlgorithm))
+
+		actual := aws.StringValue(input.ChecksumCRC32) + aws.StringValue(input.ChecksumCRC32C) +
+			aws.StringValue(input.ChecksumSHA1) + aws.StringValue(input.ChecksumSHA256)
+		assert.Equal(t, expected, actual, algorithm)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// verifyAllConcurrency is the number of objects VerifyAll reads at once.
+const verifyAllConcurrency = 8
+
+// VerifyAll reads every object of the cache and runs the configured
+// integrity checks on it: decryption with AEAD, decompression and, with
+// VerifyChecksum, the checksum. It returns the keys of the objects failing
+// them, as List reports them, and keeps going after the first. Objects
+// deleted while VerifyAll runs are skipped. It returns an error if the
+// objects can't be listed or read at all, e.g. because access is denied or
+// ctx is done.
+func (c *Cache) VerifyAll(ctx context.Context) ([]string, error) {
+	prefix, err := c.keyPrefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.log("S3 Cache VerifyAll %s", prefix)
+
+	var names []string
+	err = c.refreshingCredentials(func() error {
+		names = nil
+		return c.listObjects(ctx, prefix, func(obj *s3.Object) {
+			if name := strings.TrimPrefix(aws.StringValue(obj.Key), prefix); c.isCacheObject(name) {
+				names = append(names, name)
+			}
+		})
+	})
+	if err == nil {
+		names, err = c.verifyObjects(ctx, prefix, names)
+	}
+	if err == nil && c.storesKeys() {
+		err = c.originalKeys(ctx, prefix, names)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if isAccessDenied(err) {
+		return nil, ErrAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// verifyObjects reads the objects below prefix and returns the names of those
+// failing the integrity checks. Errors reading an object other than a miss
+// stop the verification and are returned.
+func (c *Cache) verifyObjects(ctx context.Context, prefix string, names []string) ([]string, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failed   []string
+		firstErr error
+	)
+	sem := make(chan struct{}, verifyAllConcurrency)
+	for _, name := range names {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := c.retrying(ctx, func() error {
+				return c.refreshingCredentials(func() error {
+					_, err := c.get(ctx, prefix+name)
+					return err
+				})
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil, isNotFound(err):
+			case isIntegrityError(err):
+				c.log("S3 Cache VerifyAll %s failed: %v", prefix+name, err)
+				failed = append(failed, name)
+			case firstErr == nil:
+				firstErr = err
+			}
+		}(name)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return failed, nil
+}
+
+// isIntegrityError reports whether err is a failed integrity check of the
+// data of an object, as opposed to a failure to read it.
+func isIntegrityError(err error) bool {
+	var corrupt flate.CorruptInputError
+	switch {
+	case errors.Is(err, ErrDecrypt), errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrTruncated),
+		errors.Is(err, ErrUnknownDictionary):
+		return true
+	case errors.Is(err, gzip.ErrHeader), errors.Is(err, gzip.ErrChecksum), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return errors.As(err, &corrupt)
+}
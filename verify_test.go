@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Danilo Bürger <info@danilobuerger.de>
+
+package s3cache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheVerifyAll(t *testing.T) {
+	data := bytes.Repeat([]byte("-----BEGIN CERTIFICATE-----\n"), 10)
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, Prefix: "certs/", Compress: true, VerifyChecksum: true}
+	ctx := context.Background()
+
+	for _, key := range []string{"a.example.org", "b.example.org", "c.example.org", "d.example.org"} {
+		assert.NoError(t, cache.Put(ctx, key, data))
+	}
+	cache.Compress = false
+	assert.NoError(t, cache.Put(ctx, "e.example.org", data))
+
+	// A flipped bit in the compressed data and in the checksummed data.
+	testS3Cache.cache["certs/b.example.org"][20] ^= 1
+	testS3Cache.cache["certs/e.example.org"][0] ^= 1
+	// A truncated gzip stream.
+	testS3Cache.cache["certs/d.example.org"] = testS3Cache.cache["certs/d.example.org"][:15]
+
+	failed, err := cache.VerifyAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b.example.org", "d.example.org", "e.example.org"}, failed)
+}
+
+func TestCacheVerifyAllHashKeys(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{}}
+	cache := &Cache{s3: testS3Cache, HashKeys: true, VerifyChecksum: true}
+	ctx := context.Background()
+
+	assert.NoError(t, cache.Put(ctx, "example.org", []byte{1}))
+	assert.NoError(t, cache.Put(ctx, "example.com", []byte{2}))
+	testS3Cache.cache[hashKey("example.org")] = []byte{3}
+
+	failed, err := cache.VerifyAll(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.org"}, failed)
+}
+
+func TestCacheVerifyAllError(t *testing.T) {
+	testS3Cache := &testS3{cache: map[string][]byte{"dummy": {1}}}
+	denied := awserr.NewRequestFailure(awserr.New("AccessDenied", "Access Denied", nil), http.StatusForbidden, "")
+	cache := &Cache{s3: &erroringS3{testS3: testS3Cache, err: denied}}
+
+	_, err := cache.VerifyAll(context.Background())
+	assert.Equal(t, ErrAccessDenied, err)
+}